@@ -0,0 +1,369 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Max121279/routing_ripe/src/lib"
+)
+
+// command - подкоманда командной строки
+type command struct {
+	name        string
+	description string
+	run         func(fs *flag.FlagSet, args []string) int
+}
+
+var commands = []command{
+	{"fetch", "Загрузить и проверить данные RIPE и обновить кэш, ничего не меняя в системе", cmdFetch},
+	{"plan", "Показать вычисленные подсети профилей", cmdPlan},
+	{"diff", "Показать, какие подсети добавит и удалит apply. Код 5, если изменения есть", cmdDiff},
+	{"apply", "Загрузить данные и привести маршруты к новому набору (команда по умолчанию)", cmdApply},
+	{"remove", "Удалить маршруты и правила профилей по файлам подсетей", cmdRemove},
+	{"status", "Показать число подсетей в файлах и установленных маршрутов", cmdStatus},
+	{"verify", "Проверить, что маршруты из файлов подсетей установлены. Код 5, если нет", cmdVerify},
+	{"daemon", "Работать постоянно и обновлять маршруты по расписанию", cmdDaemon},
+	{"watch", "Восстанавливать маршруты из файлов подсетей, когда интерфейс снова поднимается", cmdWatch},
+}
+
+// printUsage выводит список подкоманд
+func printUsage() {
+	fmt.Println("Использование: routing_ripe [команда] [флаги]")
+	fmt.Println()
+	fmt.Println("Команды:")
+	for _, cmd := range commands {
+		fmt.Printf("  %-8s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Println()
+	fmt.Println("Флаги команды: routing_ripe <команда> -h")
+	fmt.Println("Прежние флаги -d, -s, -p соответствуют командам remove, apply -add-only и plan.")
+}
+
+// newFlagSet создает набор флагов подкоманды со справкой по ней
+func newFlagSet(cmd command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Использование: routing_ripe %s [флаги]\n\n%s\n\nФлаги:\n", cmd.name, cmd.description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// commonOptions - флаги, общие для всех подкоманд
+type commonOptions struct {
+	profile *string
+	config  *string
+}
+
+// commonFlags добавляет общие флаги -profile и -config
+func commonFlags(fs *flag.FlagSet) commonOptions {
+	return commonOptions{
+		profile: fs.String("profile", "", "Выполнить только для профиля с этим именем"),
+		config:  fs.String("config", "", "Путь к конфигурации вместо поиска в "+strings.Join(lib.ConfigSearchPath, ", ")),
+	}
+}
+
+// setup разбирает флаги подкоманды и загружает конфигурацию. Если
+// выполнять команду не нужно (справка или ошибка), окружение равно nil,
+// а код завершения возвращается вторым значением.
+func setup(fs *flag.FlagSet, common commonOptions, args []string) (*environment, int) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, 0
+		}
+		return nil, exitUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Printf("Лишние аргументы: %s\n", strings.Join(fs.Args(), " "))
+		return nil, exitUsage
+	}
+
+	path, err := lib.FindConfig(*common.config)
+	if err != nil {
+		fmt.Printf("Ошибка загрузки конфигурации: %v\n", err)
+		return nil, exitConfig
+	}
+	env, err := loadEnvironment(path, *common.profile)
+	if err != nil {
+		fmt.Printf("Ошибка загрузки конфигурации: %v\n", err)
+		return nil, exitConfig
+	}
+	return env, 0
+}
+
+// cmdFetch загружает и проверяет данные и выводит размеры наборов
+func cmdFetch(fs *flag.FlagSet, args []string) int {
+	common := commonFlags(fs)
+	env, code := setup(fs, common, args)
+	if env == nil {
+		return code
+	}
+
+	fmt.Println("Запрос данных RIPE...")
+	plans, warnings, err := env.plans()
+	if err != nil {
+		return fetchFailed(err)
+	}
+	defer printWarnings(warnings)
+
+	for _, plan := range plans {
+		fmt.Printf("Профиль %s: получено подсетей %d\n", plan.profile.Name, len(plan.subnets))
+	}
+	return 0
+}
+
+// cmdPlan выводит вычисленные подсети профилей
+func cmdPlan(fs *flag.FlagSet, args []string) int {
+	common := commonFlags(fs)
+	env, code := setup(fs, common, args)
+	if env == nil {
+		return code
+	}
+
+	fmt.Println("Запрос данных RIPE...")
+	plans, warnings, err := env.plans()
+	if err != nil {
+		return fetchFailed(err)
+	}
+	defer printWarnings(warnings)
+
+	for _, plan := range plans {
+		fmt.Printf("Профиль %s, полученные подсети (%d):\n", plan.profile.Name, len(plan.subnets))
+		for _, subnet := range plan.subnets {
+			fmt.Println(subnet)
+		}
+	}
+	return 0
+}
+
+// cmdDiff сравнивает вычисленные наборы с файлами подсетей
+func cmdDiff(fs *flag.FlagSet, args []string) int {
+	common := commonFlags(fs)
+	quiet := fs.Bool("q", false, "Выводить только итог без списка подсетей")
+	env, code := setup(fs, common, args)
+	if env == nil {
+		return code
+	}
+
+	fmt.Println("Запрос данных RIPE...")
+	plans, warnings, err := env.plans()
+	if err != nil {
+		return fetchFailed(err)
+	}
+	defer printWarnings(warnings)
+
+	for _, plan := range plans {
+		oldSubnets, err := lib.ReadSubnetsFile(plan.profile.FilePath)
+		if err != nil {
+			fmt.Printf("Профиль %s: %v\n", plan.profile.Name, err)
+			return exitApply
+		}
+		added, removed, kept := lib.DiffSubnets(oldSubnets, plan.subnets)
+		fmt.Printf("Профиль %s: добавится %d, удалится %d, без изменений %d\n",
+			plan.profile.Name, len(added), len(removed), len(kept))
+		if !*quiet {
+			for _, subnet := range added {
+				fmt.Printf("+ %s\n", subnet)
+			}
+			for _, subnet := range removed {
+				fmt.Printf("- %s\n", subnet)
+			}
+		}
+		if len(added) > 0 || len(removed) > 0 {
+			code = exitDiff
+		}
+	}
+	return code
+}
+
+// cmdApply обновляет маршруты профилей
+func cmdApply(fs *flag.FlagSet, args []string) int {
+	common := commonFlags(fs)
+	addOnly := fs.Bool("add-only", false, "Записать файл подсетей и добавить маршруты, не удаляя исчезнувшие (прежний -s)")
+	env, code := setup(fs, common, args)
+	if env == nil {
+		return code
+	}
+	if !*addOnly {
+		return applyProfiles(env)
+	}
+
+	fmt.Println("Запрос данных RIPE...")
+	plans, warnings, err := env.plans()
+	if err != nil {
+		return fetchFailed(err)
+	}
+	defer printWarnings(warnings)
+
+	for _, plan := range plans {
+		fmt.Printf("Профиль %s: обновление файла подсетей...\n", plan.profile.Name)
+		err = lib.UpdateSubnetsFile(plan.subnets, plan.profile.FilePath)
+		if err != nil {
+			fmt.Printf("Ошибка обновления файла: %v\n", err)
+			code = exitApply
+			continue
+		}
+
+		// Добавление новых маршрутов
+		err = lib.AddRoutes(env.backends[plan.profile.Name], plan.profile.FilePath)
+		if err != nil {
+			fmt.Printf("Ошибка при добавлении новых маршрутов: %v\n", err)
+			code = exitApply
+		}
+		if err = applyPolicy(&plan.profile); err != nil {
+			fmt.Printf("Ошибка при установке правил: %v\n", err)
+			code = exitApply
+		}
+	}
+	return code
+}
+
+// cmdRemove удаляет правила и маршруты профилей
+func cmdRemove(fs *flag.FlagSet, args []string) int {
+	common := commonFlags(fs)
+	env, code := setup(fs, common, args)
+	if env == nil {
+		return code
+	}
+
+	fmt.Println("Очистка старых маршрутов...")
+	for _, profile := range env.profiles() {
+		// Сначала убираем правила, чтобы трафик не уходил в пустеющую таблицу
+		if err := removePolicy(&profile); err != nil {
+			fmt.Printf("Профиль %s: ошибка при удалении правил: %v\n", profile.Name, err)
+			code = exitApply
+		}
+		err := lib.RemoveRoutes(env.backends[profile.Name], profile.FilePath)
+		if err != nil {
+			fmt.Printf("Профиль %s: ошибка при удалении старых маршрутов: %v\n", profile.Name, err)
+			code = exitApply
+		}
+	}
+	return code
+}
+
+// cmdStatus выводит состояние профилей без запроса RIPE
+func cmdStatus(fs *flag.FlagSet, args []string) int {
+	common := commonFlags(fs)
+	env, code := setup(fs, common, args)
+	if env == nil {
+		return code
+	}
+
+	for _, profile := range env.profiles() {
+		backend := env.backends[profile.Name]
+		fmt.Printf("Профиль %s (%s), файл %s\n", profile.Name, backend.Name(), profile.FilePath)
+
+		saved, err := lib.ReadSubnetsFile(profile.FilePath)
+		if err != nil {
+			fmt.Printf("  %v\n", err)
+			code = exitApply
+		} else {
+			fmt.Printf("  подсетей в файле: %d\n", len(saved))
+		}
+		installed, err := backend.List()
+		if err != nil {
+			fmt.Printf("  %v\n", err)
+			code = exitApply
+		} else {
+			fmt.Printf("  установлено маршрутов: %d\n", len(installed))
+		}
+
+		rules, _ := profile.PolicyRules()
+		for _, rule := range rules {
+			ok, err := lib.RuleInstalled(rule)
+			switch {
+			case err != nil:
+				fmt.Printf("  %v\n", err)
+				code = exitApply
+			case ok:
+				fmt.Printf("  правило %s установлено\n", rule)
+			default:
+				fmt.Printf("  правило %s не установлено\n", rule)
+			}
+		}
+	}
+	return code
+}
+
+// cmdVerify проверяет, что подсети из файлов установлены бэкендом. Лишние
+// маршруты только выводятся: на том же интерфейсе могут быть маршруты
+// другого профиля.
+func cmdVerify(fs *flag.FlagSet, args []string) int {
+	common := commonFlags(fs)
+	fix := fs.Bool("fix", false, "Установить недостающие маршруты и правила")
+	env, code := setup(fs, common, args)
+	if env == nil {
+		return code
+	}
+
+	for _, profile := range env.profiles() {
+		backend := env.backends[profile.Name]
+		saved, err := lib.ReadSubnetsFile(profile.FilePath)
+		if err != nil {
+			fmt.Printf("Профиль %s: %v\n", profile.Name, err)
+			return exitApply
+		}
+		installed, err := backend.List()
+		if err != nil {
+			fmt.Printf("Профиль %s: %v\n", profile.Name, err)
+			return exitApply
+		}
+
+		missing, extra, _ := lib.DiffSubnets(installed, saved)
+		missingRules := 0
+		rules, _ := profile.PolicyRules()
+		for _, rule := range rules {
+			if ok, err := lib.RuleInstalled(rule); err != nil || !ok {
+				missingRules++
+			}
+		}
+		fmt.Printf("Профиль %s: не установлено маршрутов %d, правил %d, лишних маршрутов %d\n",
+			profile.Name, len(missing), missingRules, len(extra))
+		for _, subnet := range missing {
+			fmt.Printf("нет маршрута %s\n", subnet)
+		}
+		if len(missing) == 0 && missingRules == 0 {
+			continue
+		}
+
+		if !*fix {
+			code = exitDiff
+			continue
+		}
+		if _, err = lib.AddRouteList(backend, missing); err != nil {
+			fmt.Printf("Ошибка при добавлении маршрутов: %v\n", err)
+			code = exitApply
+		}
+		if err = applyPolicy(&profile); err != nil {
+			fmt.Printf("Ошибка при установке правил: %v\n", err)
+			code = exitApply
+		}
+	}
+	return code
+}
+
+// cmdDaemon обновляет маршруты по расписанию
+func cmdDaemon(fs *flag.FlagSet, args []string) int {
+	common := commonFlags(fs)
+	interval := fs.Duration("interval", 0, "Период обновления вместо refresh_interval из конфигурации")
+	env, code := setup(fs, common, args)
+	if env == nil {
+		return code
+	}
+	return runDaemon(env, *interval)
+}
+
+// cmdWatch восстанавливает маршруты при появлении интерфейсов
+func cmdWatch(fs *flag.FlagSet, args []string) int {
+	common := commonFlags(fs)
+	env, code := setup(fs, common, args)
+	if env == nil {
+		return code
+	}
+	return watchInterfaces(env)
+}
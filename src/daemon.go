@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Max121279/routing_ripe/src/lib"
+)
+
+// daemonState - окружение демона, которое заменяется целиком по SIGHUP
+type daemonState struct {
+	env      *environment
+	schedule *lib.Schedule
+}
+
+// newDaemonState готовит расписание. interval, если он задан, заменяет
+// период обновления из конфигурации.
+func newDaemonState(env *environment, interval time.Duration) (*daemonState, error) {
+	schedule, err := env.config.Schedule()
+	if err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		schedule.Interval = interval
+	}
+	return &daemonState{env: env, schedule: schedule}, nil
+}
+
+// runDaemon обновляет маршруты по расписанию из конфигурации, пока не придет
+// SIGINT или SIGTERM. Начатое обновление всегда доводится до конца.
+// SIGHUP перечитывает конфигурацию и запускает обновление сразу.
+func runDaemon(env *environment, interval time.Duration) int {
+	state, err := newDaemonState(env, interval)
+	if err != nil {
+		fmt.Printf("Ошибка загрузки конфигурации: %v\n", err)
+		return exitConfig
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	failures := 0
+	for {
+		// При недоступности RIPE повторяем раньше, с растущей задержкой
+		if retryNeeded(applyProfiles(state.env), state.env.stale) {
+			failures++
+		} else {
+			failures = 0
+		}
+
+		delay := state.schedule.Next(failures)
+		fmt.Printf("Следующее обновление через %v\n", delay.Round(time.Second))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case sig := <-signals:
+			timer.Stop()
+			if sig != syscall.SIGHUP {
+				fmt.Printf("Получен сигнал %v, завершение работы\n", sig)
+				return 0
+			}
+
+			// Новая конфигурация применяется, только если она полностью корректна
+			fmt.Println("Получен SIGHUP, перечитываем конфигурацию...")
+			newState, err := reloadDaemonState(state.env, interval)
+			if err != nil {
+				fmt.Printf("Ошибка загрузки конфигурации, используется прежняя: %v\n", err)
+			} else {
+				state = newState
+			}
+			failures = 0
+		}
+	}
+}
+
+// retryNeeded сообщает, что обновление нужно повторить раньше обычного:
+// данные не получены или не прошли проверку, либо часть их взята из кэша
+func retryNeeded(code int, stale bool) bool {
+	return code == exitFetch || code == exitValidate || stale
+}
+
+// reloadDaemonState заново читает конфигурацию из того же файла
+func reloadDaemonState(env *environment, interval time.Duration) (*daemonState, error) {
+	env, err := loadEnvironment(env.configPath, env.only)
+	if err != nil {
+		return nil, err
+	}
+	return newDaemonState(env, interval)
+}
@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AnnouncedPrefixesURL - запрос RIPEstat announced-prefixes, к нему добавляется номер AS
+const AnnouncedPrefixesURL = "https://stat.ripe.net/data/announced-prefixes/data.json?resource=AS"
+
+// ParseASN разбирает номер автономной системы в виде AS15169 или 15169
+func ParseASN(value string) (uint32, error) {
+	value = strings.TrimSpace(value)
+	if len(value) > 2 && strings.EqualFold(value[:2], "AS") {
+		value = value[2:]
+	}
+	asn, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || asn == 0 {
+		return 0, fmt.Errorf("некорректный номер AS %q", value)
+	}
+	return uint32(asn), nil
+}
+
+// ParseAnnouncedPrefixes возвращает подсети из ответа RIPEstat
+// announced-prefixes или из сохраненного файла в том же формате
+func ParseAnnouncedPrefixes(body []byte) ([]string, error) {
+	var result struct {
+		Status string `json:"status"`
+		Data   struct {
+			Prefixes []struct {
+				Prefix string `json:"prefix"`
+			} `json:"prefixes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("ошибка разбора JSON: %v", err)
+	}
+	if result.Status != "" && result.Status != "ok" {
+		return nil, fmt.Errorf("RIPEstat вернул статус %s", result.Status)
+	}
+
+	prefixes := make([]string, 0, len(result.Data.Prefixes))
+	for _, prefix := range result.Data.Prefixes {
+		prefixes = append(prefixes, prefix.Prefix)
+	}
+	return prefixes, nil
+}
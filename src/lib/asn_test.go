@@ -0,0 +1,52 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Тест для ParseASN
+func TestParseASN(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected uint32
+		valid    bool
+	}{
+		{"AS15169", 15169, true},
+		{"as8359", 8359, true},
+		{" 13238 ", 13238, true},
+		{"AS", 0, false},
+		{"0", 0, false},
+		{"AS4294967296", 0, false},
+		{"google", 0, false},
+	}
+
+	for _, test := range tests {
+		result, err := ParseASN(test.value)
+		if (err == nil) != test.valid || result != test.expected {
+			t.Errorf("ParseASN(%q) = %v, %v; ожидается %v", test.value, result, err, test.expected)
+		}
+	}
+}
+
+// Тест для ParseAnnouncedPrefixes
+func TestParseAnnouncedPrefixes(t *testing.T) {
+	body := `{"status": "ok", "data": {"resource": "15169", "prefixes": [
+		{"prefix": "8.8.8.0/24", "timelines": [{"starttime": "2024-01-01T00:00:00", "endtime": "2024-01-15T00:00:00"}]},
+		{"prefix": "2001:4860::/32", "timelines": []}
+	]}}`
+	result, err := ParseAnnouncedPrefixes([]byte(body))
+	if err != nil {
+		t.Fatalf("Ошибка ParseAnnouncedPrefixes: %v", err)
+	}
+	expected := []string{"8.8.8.0/24", "2001:4860::/32"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("ParseAnnouncedPrefixes() = %v; ожидается %v", result, expected)
+	}
+
+	for _, body := range []string{`<html>`, `{"status": "error", "data": {}}`} {
+		if _, err = ParseAnnouncedPrefixes([]byte(body)); err == nil {
+			t.Errorf("ParseAnnouncedPrefixes(%s) должна вернуть ошибку", body)
+		}
+	}
+}
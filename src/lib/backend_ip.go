@@ -0,0 +1,211 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// IPBackend устанавливает маршруты командой ip из iproute2.
+// Все команды передаются одному процессу `ip -force -batch -`,
+// отдельно для IPv4 (`ip -4`) и IPv6 (`ip -6`).
+type IPBackend struct {
+	RouteOptions
+}
+
+func (b *IPBackend) Name() string { return "ip" }
+
+// Add добавляет маршруты одним пакетом команд ip
+func (b *IPBackend) Add(subnets []string) ([]RouteResult, error) {
+	return runByFamily(subnets, func(subnets []string, v6 bool) ([]RouteResult, error) {
+		return b.run(subnets, "add", v6), nil
+	})
+}
+
+// Delete удаляет маршруты одним пакетом команд ip
+func (b *IPBackend) Delete(subnets []string) ([]RouteResult, error) {
+	return runByFamily(subnets, func(subnets []string, v6 bool) ([]RouteResult, error) {
+		return b.run(subnets, "del", v6), nil
+	})
+}
+
+// List возвращает статические маршруты (proto boot) через интерфейс или шлюз
+func (b *IPBackend) List() ([]string, error) {
+	var subnets []string
+	for _, v6 := range []bool{false, true} {
+		if !b.configured(v6) {
+			continue
+		}
+		args := []string{familyFlag(v6), "route", "show", "table", strconv.Itoa(b.table()),
+			"proto", strconv.Itoa(b.protocol()), "type", b.routeType()}
+		if b.unicast() {
+			if iface := b.iface(v6); iface != "" {
+				args = append(args, "dev", iface)
+			}
+			if gateway := b.gateway(v6); gateway != "" {
+				args = append(args, "via", gateway)
+			}
+		}
+		output, err := exec.Command("ip", args...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения таблицы маршрутов: %v", err)
+		}
+		subnets = append(subnets, parseRouteList(string(output))...)
+	}
+	return subnets, nil
+}
+
+// Flush удаляет все маршруты, которые возвращает List
+func (b *IPBackend) Flush() error {
+	subnets, err := b.List()
+	if err != nil {
+		return err
+	}
+	_, err = b.Delete(subnets)
+	return err
+}
+
+// run выполняет команды пакетом. Если ip не поддерживает -batch или
+// прервал пакет без указания строки, команды повторяются по одной.
+func (b *IPBackend) run(subnets []string, action string, v6 bool) []RouteResult {
+	results := make([]RouteResult, len(subnets))
+	var script strings.Builder
+	var lines []int
+	for i, subnet := range subnets {
+		results[i].Subnet = subnet
+		// Некорректный префикс прерывает весь пакет, поэтому проверяем заранее
+		if _, err := netip.ParsePrefix(subnet); err != nil {
+			results[i].Err = fmt.Errorf("ошибка разбора подсети: %v", err)
+			continue
+		}
+		fmt.Fprintf(&script, "route %s %s\n", action, strings.Join(b.routeArgs(subnet, v6), " "))
+		lines = append(lines, i)
+	}
+	if len(lines) == 0 {
+		return results
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("ip", familyFlag(v6), "-force", "-batch", "-")
+	cmd.Stdin = strings.NewReader(script.String())
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	failures := parseBatchErrors(stderr.String())
+	if runErr != nil && len(failures) == 0 {
+		for _, i := range lines {
+			results[i].Err = b.runSingle(subnets[i], action, v6)
+		}
+		return results
+	}
+
+	for line, message := range failures {
+		if line < 1 || line > len(lines) || isBenignRouteError(action, message) {
+			continue
+		}
+		results[lines[line-1]].Err = fmt.Errorf("%s", message)
+	}
+	return results
+}
+
+// runSingle выполняет одну команду ip route
+func (b *IPBackend) runSingle(subnet, action string, v6 bool) error {
+	args := append([]string{familyFlag(v6), "route", action}, b.routeArgs(subnet, v6)...)
+	output, err := exec.Command("ip", args...).CombinedOutput()
+	message := strings.TrimSpace(string(output))
+	if err != nil && !isBenignRouteError(action, message) {
+		return fmt.Errorf("%s", message)
+	}
+	return nil
+}
+
+// routeArgs возвращает аргументы ip route для подсети. Одни и те же
+// аргументы используются для add и del, чтобы удалялся именно наш маршрут.
+func (b *IPBackend) routeArgs(subnet string, v6 bool) []string {
+	args := []string{b.routeType(), subnet}
+	if b.unicast() {
+		if gateway := b.gateway(v6); gateway != "" {
+			args = append(args, "via", gateway)
+		}
+		if iface := b.iface(v6); iface != "" {
+			args = append(args, "dev", iface)
+		}
+	}
+	if b.Metric != 0 {
+		args = append(args, "metric", strconv.Itoa(b.Metric))
+	}
+	return append(args, "table", strconv.Itoa(b.table()), "proto", strconv.Itoa(b.protocol()))
+}
+
+func (b *IPBackend) routeType() string {
+	if b.unicast() {
+		return "unicast"
+	}
+	return b.Type
+}
+
+// familyFlag возвращает ключ семейства адресов для команды ip
+func familyFlag(v6 bool) string {
+	if v6 {
+		return "-6"
+	}
+	return "-4"
+}
+
+var batchFailedLine = regexp.MustCompile(`^Command failed -:(\d+)$`)
+
+// parseBatchErrors сопоставляет сообщения об ошибках из вывода
+// `ip -batch` с номерами строк пакета
+func parseBatchErrors(output string) map[int]string {
+	failures := make(map[int]string)
+	var messages []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if m := batchFailedLine.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			failures[n] = strings.Join(messages, "; ")
+			messages = nil
+			continue
+		}
+		messages = append(messages, line)
+	}
+	return failures
+}
+
+// isBenignRouteError сообщает, что маршрут уже в нужном состоянии:
+// при добавлении он уже существует, при удалении его уже нет
+func isBenignRouteError(action, message string) bool {
+	switch action {
+	case "add":
+		return strings.Contains(message, "File exists")
+	case "del":
+		return strings.Contains(message, "No such process")
+	}
+	return false
+}
+
+// parseRouteList извлекает подсети назначения из вывода `ip route show`.
+// Маршрут по умолчанию пропускается, адреса хостов дополняются длиной префикса.
+func parseRouteList(output string) []string {
+	var subnets []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		// Тип маршрута, если он указан, идет перед адресом назначения
+		if len(fields) > 1 && slices.Contains(routeTypes, fields[0]) {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 || fields[0] == "default" {
+			continue
+		}
+		subnets = append(subnets, hostPrefix(fields[0]))
+	}
+	return subnets
+}
@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Тест для parseRouteList
+func TestParseRouteList(t *testing.T) {
+	output := "default dev ppp0 scope link\n" +
+		"5.8.0.0/16 dev ppp0 scope link\n" +
+		"5.9.1.1 dev ppp0 scope link\n" +
+		"2a00:1::/32 dev ppp0 metric 1024 pref medium\n" +
+		"blackhole 10.0.0.0/8 proto static\n"
+
+	expected := []string{"5.8.0.0/16", "5.9.1.1/32", "2a00:1::/32", "10.0.0.0/8"}
+	if result := parseRouteList(output); !reflect.DeepEqual(result, expected) {
+		t.Errorf("parseRouteList() = %v; ожидается %v", result, expected)
+	}
+}
+
+// Тест для parseBatchErrors
+func TestParseBatchErrors(t *testing.T) {
+	output := "RTNETLINK answers: File exists\n" +
+		"Command failed -:2\n" +
+		"Error: Nexthop device is not up.\n" +
+		"Command failed -:5\n"
+
+	expected := map[int]string{
+		2: "RTNETLINK answers: File exists",
+		5: "Error: Nexthop device is not up.",
+	}
+	if result := parseBatchErrors(output); !reflect.DeepEqual(result, expected) {
+		t.Errorf("parseBatchErrors() = %v; ожидается %v", result, expected)
+	}
+}
+
+// Тест для isBenignRouteError
+func TestIsBenignRouteError(t *testing.T) {
+	tests := []struct {
+		action   string
+		message  string
+		expected bool
+	}{
+		{"add", "RTNETLINK answers: File exists", true},
+		{"del", "RTNETLINK answers: No such process", true},
+		{"add", "RTNETLINK answers: No such process", false},
+		{"del", "RTNETLINK answers: File exists", false},
+		{"add", "Error: Nexthop device is not up.", false},
+	}
+
+	for _, test := range tests {
+		if result := isBenignRouteError(test.action, test.message); result != test.expected {
+			t.Errorf("isBenignRouteError(%s, %q) = %v; ожидается %v", test.action, test.message, result, test.expected)
+		}
+	}
+}
+
+// Тест для IPBackend.routeArgs: параметры маршрута одинаковы для add и del
+func TestIPBackendRouteArgs(t *testing.T) {
+	tests := []struct {
+		options  RouteOptions
+		v6       bool
+		expected string
+	}{
+		{
+			RouteOptions{Interface: "ppp0"}, false,
+			"unicast 5.8.0.0/16 dev ppp0 table 254 proto 3",
+		},
+		{
+			RouteOptions{Interface: "wg0", Gateway: "10.8.0.1", Metric: 50, Table: 100, Protocol: 4}, false,
+			"unicast 5.8.0.0/16 via 10.8.0.1 dev wg0 metric 50 table 100 proto 4",
+		},
+		{
+			RouteOptions{Interface: "ppp0", InterfaceV6: "he-ipv6", Gateway: "10.8.0.1"}, true,
+			"unicast 5.8.0.0/16 dev he-ipv6 table 254 proto 3",
+		},
+		{
+			RouteOptions{Interface: "ppp0", Type: "blackhole"}, false,
+			"blackhole 5.8.0.0/16 table 254 proto 3",
+		},
+	}
+
+	for _, test := range tests {
+		b := &IPBackend{RouteOptions: test.options}
+		if result := strings.Join(b.routeArgs("5.8.0.0/16", test.v6), " "); result != test.expected {
+			t.Errorf("routeArgs(%+v) = %q; ожидается %q", test.options, result, test.expected)
+		}
+	}
+}
+
+// Тест для разбора таблицы, протокола и типа маршрута из конфигурации
+func TestProfileRouteOptions(t *testing.T) {
+	profile := &Profile{Table: "100", Proto: "static", RouteType: "unreachable", Metric: 10}
+	options, err := profile.RouteOptions()
+	if err != nil {
+		t.Fatalf("Ошибка RouteOptions: %v", err)
+	}
+	if options.Table != 100 || options.Protocol != 4 || options.Type != "unreachable" || options.Metric != 10 {
+		t.Errorf("RouteOptions() = %+v", options)
+	}
+
+	// Без файлов rt_tables имя vpn неизвестно
+	saved := routeTablesFiles
+	routeTablesFiles = nil
+	defer func() { routeTablesFiles = saved }()
+	for _, invalid := range []Profile{{Table: "vpn"}, {Proto: "300"}, {RouteType: "local"}, {Metric: -1}} {
+		if _, err = invalid.RouteOptions(); err == nil {
+			t.Errorf("RouteOptions(%+v) должна вернуть ошибку", invalid)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package lib
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// ipsetMaxName - максимальная длина имени набора ipset
+	ipsetMaxName = 31
+	// ipsetTmpSuffix - суффикс временного набора, который подменяет основной
+	ipsetTmpSuffix = "_tmp"
+	// ipsetMinElements - размер набора по умолчанию в ipset
+	ipsetMinElements = 65536
+)
+
+// IPSetBackend заполняет наборы ipset hash:net вместо таблицы маршрутов.
+// IPv4 подсети попадают в набор SetName, IPv6 - в SetName_v6. Трафик
+// помечается правилами межсетевого экрана, которые ссылаются на эти наборы.
+type IPSetBackend struct {
+	RouteOptions
+}
+
+func (b *IPSetBackend) Name() string { return "ipset" }
+
+// Add добавляет подсети в наборы, создавая их при необходимости
+func (b *IPSetBackend) Add(subnets []string) ([]RouteResult, error) {
+	names, err := ipsetNames()
+	if err != nil {
+		return nil, err
+	}
+	return runByFamily(subnets, func(subnets []string, v6 bool) ([]RouteResult, error) {
+		results, valid := checkSubnets(subnets)
+		var script strings.Builder
+		if !names[b.setName(v6)] {
+			fmt.Fprintf(&script, "create %s\n", ipsetSpec(b.setName(v6), v6, len(valid)))
+		}
+		for _, subnet := range valid {
+			fmt.Fprintf(&script, "add %s %s\n", b.setName(v6), subnet)
+		}
+		return results, ipsetRestore(script.String())
+	})
+}
+
+// Delete удаляет подсети из наборов. Отсутствие подсети или набора не ошибка.
+func (b *IPSetBackend) Delete(subnets []string) ([]RouteResult, error) {
+	names, err := ipsetNames()
+	if err != nil {
+		return nil, err
+	}
+	return runByFamily(subnets, func(subnets []string, v6 bool) ([]RouteResult, error) {
+		results, valid := checkSubnets(subnets)
+		if !names[b.setName(v6)] {
+			return results, nil
+		}
+		var script strings.Builder
+		for _, subnet := range valid {
+			fmt.Fprintf(&script, "del %s %s\n", b.setName(v6), subnet)
+		}
+		return results, ipsetRestore(script.String())
+	})
+}
+
+// List возвращает подсети из наборов профиля
+func (b *IPSetBackend) List() ([]string, error) {
+	names, err := ipsetNames()
+	if err != nil {
+		return nil, err
+	}
+	var subnets []string
+	for _, v6 := range []bool{false, true} {
+		name := b.setName(v6)
+		if !names[name] {
+			continue
+		}
+		output, err := exec.Command("ipset", "save", name).Output()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения набора ipset %s: %v", name, err)
+		}
+		subnets = append(subnets, parseIPSetSave(string(output), name)...)
+	}
+	return subnets, nil
+}
+
+// Flush очищает наборы, не удаляя их: на них могут ссылаться правила iptables
+func (b *IPSetBackend) Flush() error {
+	names, err := ipsetNames()
+	if err != nil {
+		return err
+	}
+	var script strings.Builder
+	for _, v6 := range []bool{false, true} {
+		if names[b.setName(v6)] {
+			fmt.Fprintf(&script, "flush %s\n", b.setName(v6))
+		}
+	}
+	return ipsetRestore(script.String())
+}
+
+// Replace атомарно заменяет содержимое наборов: новые подсети загружаются
+// во временный набор, который меняется местами с основным и удаляется
+func (b *IPSetBackend) Replace(subnets []string) error {
+	names, err := ipsetNames()
+	if err != nil {
+		return err
+	}
+	script, err := b.replaceScript(subnets, names)
+	if err != nil {
+		return err
+	}
+	return ipsetRestore(script)
+}
+
+// replaceScript составляет команды ipset restore для замены наборов.
+// IPv6 набор заменяется, только если есть IPv6 подсети или он уже существует.
+func (b *IPSetBackend) replaceScript(subnets []string, names map[string]bool) (string, error) {
+	results, _ := checkSubnets(subnets)
+	for _, result := range results {
+		if result.Err != nil {
+			return "", fmt.Errorf("%s: %v", result.Subnet, result.Err)
+		}
+	}
+
+	v4, v6 := splitByFamily(subnets)
+	var script strings.Builder
+	for _, group := range []struct {
+		subnets []string
+		v6      bool
+	}{{v4, false}, {v6, true}} {
+		name := b.setName(group.v6)
+		if group.v6 && len(group.subnets) == 0 && !names[name] {
+			continue
+		}
+		tmp := name + ipsetTmpSuffix
+
+		// Временный набор мог остаться от прерванного запуска
+		if names[tmp] {
+			fmt.Fprintf(&script, "destroy %s\n", tmp)
+		}
+		if !names[name] {
+			fmt.Fprintf(&script, "create %s\n", ipsetSpec(name, group.v6, len(group.subnets)))
+		}
+		fmt.Fprintf(&script, "create %s\n", ipsetSpec(tmp, group.v6, len(group.subnets)))
+		for _, subnet := range group.subnets {
+			fmt.Fprintf(&script, "add %s %s\n", tmp, subnet)
+		}
+		fmt.Fprintf(&script, "swap %s %s\n", tmp, name)
+		fmt.Fprintf(&script, "destroy %s\n", tmp)
+	}
+	return script.String(), nil
+}
+
+// ipsetSpec возвращает параметры создания набора hash:net
+// с запасом по размеру для указанного числа подсетей
+func ipsetSpec(name string, v6 bool, elements int) string {
+	family := "inet"
+	if v6 {
+		family = "inet6"
+	}
+	return fmt.Sprintf("%s hash:net family %s maxelem %d", name, family, max(ipsetMinElements, elements*2))
+}
+
+// ipsetNames возвращает имена существующих наборов ipset
+func ipsetNames() (map[string]bool, error) {
+	output, err := exec.Command("ipset", "list", "-name").Output()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения списка наборов ipset: %v", err)
+	}
+	names := make(map[string]bool)
+	for _, name := range strings.Fields(string(output)) {
+		names[name] = true
+	}
+	return names, nil
+}
+
+// ipsetRestore выполняет команды одним процессом `ipset restore`.
+// С ключом -exist повторное добавление и удаление отсутствующего не ошибка.
+func ipsetRestore(script string) error {
+	if script == "" {
+		return nil
+	}
+	cmd := exec.Command("ipset", "restore", "-exist")
+	cmd.Stdin = strings.NewReader(script)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ошибка ipset restore: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// parseIPSetSave извлекает подсети набора из вывода `ipset save`.
+// Адреса хостов дополняются длиной префикса.
+func parseIPSetSave(output, name string) []string {
+	var subnets []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "add" || fields[1] != name {
+			continue
+		}
+		subnets = append(subnets, hostPrefix(fields[2]))
+	}
+	return subnets
+}
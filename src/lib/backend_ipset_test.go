@@ -0,0 +1,56 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Тест для IPSetBackend.replaceScript: новый набор подменяет старый через временный
+func TestIPSetReplaceScript(t *testing.T) {
+	b := &IPSetBackend{RouteOptions{SetName: "ripe_ru"}}
+	names := map[string]bool{"ripe_ru": true, "ripe_ru_tmp": true}
+
+	script, err := b.replaceScript([]string{"5.8.0.0/16", "2a00:1::/32"}, names)
+	if err != nil {
+		t.Fatalf("Ошибка replaceScript: %v", err)
+	}
+	expected := "destroy ripe_ru_tmp\n" +
+		"create ripe_ru_tmp hash:net family inet maxelem 65536\n" +
+		"add ripe_ru_tmp 5.8.0.0/16\n" +
+		"swap ripe_ru_tmp ripe_ru\n" +
+		"destroy ripe_ru_tmp\n" +
+		"create ripe_ru_v6 hash:net family inet6 maxelem 65536\n" +
+		"create ripe_ru_v6_tmp hash:net family inet6 maxelem 65536\n" +
+		"add ripe_ru_v6_tmp 2a00:1::/32\n" +
+		"swap ripe_ru_v6_tmp ripe_ru_v6\n" +
+		"destroy ripe_ru_v6_tmp\n"
+	if script != expected {
+		t.Errorf("replaceScript() = %q; ожидается %q", script, expected)
+	}
+
+	// Без IPv6 подсетей несуществующий IPv6 набор не создается
+	script, _ = b.replaceScript(nil, map[string]bool{"ripe_ru": true})
+	expected = "create ripe_ru_tmp hash:net family inet maxelem 65536\n" +
+		"swap ripe_ru_tmp ripe_ru\n" +
+		"destroy ripe_ru_tmp\n"
+	if script != expected {
+		t.Errorf("replaceScript(nil) = %q; ожидается %q", script, expected)
+	}
+
+	if _, err = b.replaceScript([]string{"5.8.0.0/33"}, names); err == nil {
+		t.Errorf("replaceScript с некорректной подсетью должна вернуть ошибку")
+	}
+}
+
+// Тест для parseIPSetSave
+func TestParseIPSetSave(t *testing.T) {
+	output := "create ripe_ru hash:net family inet hashsize 1024 maxelem 65536\n" +
+		"add ripe_ru 5.8.0.0/16\n" +
+		"add ripe_ru 5.9.1.1\n" +
+		"add other 10.0.0.0/8\n"
+
+	expected := []string{"5.8.0.0/16", "5.9.1.1/32"}
+	if result := parseIPSetSave(output, "ripe_ru"); !reflect.DeepEqual(result, expected) {
+		t.Errorf("parseIPSetSave() = %v; ожидается %v", result, expected)
+	}
+}
@@ -0,0 +1,285 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	// DefaultRciURL - адрес RCI API при запуске на самом роутере Keenetic
+	DefaultRciURL = "http://127.0.0.1:79/rci/"
+	// keeneticBatchSize - число команд в одном запросе к RCI
+	keeneticBatchSize = 200
+)
+
+// KeeneticBackend добавляет статические маршруты в конфигурацию роутера
+// Keenetic через RCI API. Такие маршруты видны в веб-интерфейсе и не
+// сбрасываются NDM при переподключении. Маршруты помечаются комментарием
+// Comment, и List возвращает только помеченные маршруты.
+type KeeneticBackend struct {
+	RouteOptions
+}
+
+// keeneticRoute - статический маршрут в формате RCI (команды ip route и ipv6 route)
+type keeneticRoute struct {
+	Network   string `json:"network,omitempty"`
+	Mask      string `json:"mask,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
+	Interface string `json:"interface,omitempty"`
+	Gateway   string `json:"gateway,omitempty"`
+	Auto      bool   `json:"auto,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	No        bool   `json:"no,omitempty"`
+}
+
+func (b *KeeneticBackend) Name() string { return "keenetic" }
+
+// Add добавляет маршруты в конфигурацию роутера и сохраняет ее
+func (b *KeeneticBackend) Add(subnets []string) ([]RouteResult, error) {
+	return b.apply(subnets, false)
+}
+
+// Delete удаляет маршруты из конфигурации роутера и сохраняет ее
+func (b *KeeneticBackend) Delete(subnets []string) ([]RouteResult, error) {
+	return b.apply(subnets, true)
+}
+
+// List возвращает маршруты, помеченные комментарием профиля
+func (b *KeeneticBackend) List() ([]string, error) {
+	var subnets []string
+	for _, v6 := range []bool{false, true} {
+		if !b.configured(v6) {
+			continue
+		}
+		routes, err := b.routes(v6)
+		if err != nil {
+			return nil, err
+		}
+		for _, route := range routes {
+			if route.Comment != b.Comment {
+				continue
+			}
+			if prefix, err := route.prefix(); err == nil {
+				subnets = append(subnets, prefix.String())
+			}
+		}
+	}
+	return subnets, nil
+}
+
+// Flush удаляет все маршруты, которые возвращает List
+func (b *KeeneticBackend) Flush() error {
+	subnets, err := b.List()
+	if err != nil {
+		return err
+	}
+	_, err = b.Delete(subnets)
+	return err
+}
+
+// apply отправляет команды пакетами и сохраняет конфигурацию
+func (b *KeeneticBackend) apply(subnets []string, remove bool) ([]RouteResult, error) {
+	results := make([]RouteResult, len(subnets))
+	var commands []any
+	var indexes []int
+	for i, subnet := range subnets {
+		results[i].Subnet = subnet
+		prefix, err := netip.ParsePrefix(subnet)
+		if err != nil {
+			results[i].Err = fmt.Errorf("ошибка разбора подсети: %v", err)
+			continue
+		}
+		commands = append(commands, b.routeCommand(prefix, remove))
+		indexes = append(indexes, i)
+	}
+	if len(commands) == 0 {
+		return results, nil
+	}
+
+	for start := 0; start < len(commands); start += keeneticBatchSize {
+		end := min(start+keeneticBatchSize, len(commands))
+		responses, err := b.post(commands[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for j, response := range responses {
+			if message := rciError(response); message != "" && !(remove && isMissingRoute(message)) {
+				results[indexes[start+j]].Err = fmt.Errorf("%s", message)
+			}
+		}
+	}
+
+	if err := b.save(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// routeCommand возвращает команду RCI для маршрута. Удаление использует
+// те же поля, что и добавление, с признаком no.
+func (b *KeeneticBackend) routeCommand(prefix netip.Prefix, remove bool) any {
+	v6 := prefix.Addr().Is6()
+	route := keeneticRoute{
+		Interface: b.iface(v6),
+		Gateway:   b.gateway(v6),
+		Auto:      !remove,
+		No:        remove,
+	}
+	if !remove {
+		route.Comment = b.Comment
+	}
+
+	if v6 {
+		route.Prefix = prefix.Masked().String()
+		return map[string]any{"ipv6": map[string]any{"route": route}}
+	}
+	route.Network = prefix.Masked().Addr().String()
+	route.Mask = net.IP(net.CIDRMask(prefix.Bits(), 32)).String()
+	return map[string]any{"ip": map[string]any{"route": route}}
+}
+
+// prefix возвращает подсеть маршрута RCI
+func (r keeneticRoute) prefix() (netip.Prefix, error) {
+	if r.Prefix != "" {
+		return netip.ParsePrefix(r.Prefix)
+	}
+	addr, err := netip.ParseAddr(r.Network)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	mask := net.ParseIP(r.Mask).To4()
+	if mask == nil {
+		return netip.Prefix{}, fmt.Errorf("некорректная маска %s", r.Mask)
+	}
+	bits, size := net.IPMask(mask).Size()
+	if size == 0 {
+		return netip.Prefix{}, fmt.Errorf("некорректная маска %s", r.Mask)
+	}
+	return netip.PrefixFrom(addr, bits), nil
+}
+
+// routes читает статические маршруты семейства адресов из конфигурации роутера
+func (b *KeeneticBackend) routes(v6 bool) ([]keeneticRoute, error) {
+	path := "ip/route"
+	if v6 {
+		path = "ipv6/route"
+	}
+	response, err := httpClient.Get(b.rciURL() + path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к RCI: %v", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения ответа RCI: %v", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("RCI вернул статус %d", response.StatusCode)
+	}
+
+	// Если маршрутов нет, RCI может вернуть пустой объект вместо списка
+	var routes []keeneticRoute
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '[' {
+		return nil, nil
+	}
+	if err = json.Unmarshal(body, &routes); err != nil {
+		return nil, fmt.Errorf("ошибка разбора маршрутов RCI: %v", err)
+	}
+	return routes, nil
+}
+
+// save сохраняет текущую конфигурацию роутера
+func (b *KeeneticBackend) save() error {
+	command := map[string]any{"system": map[string]any{"configuration": map[string]any{"save": map[string]any{}}}}
+	responses, err := b.post([]any{command})
+	if err != nil {
+		return err
+	}
+	if message := rciError(responses[0]); message != "" {
+		return fmt.Errorf("ошибка сохранения конфигурации: %s", message)
+	}
+	return nil
+}
+
+// post отправляет пакет команд RCI и возвращает ответ на каждую команду
+func (b *KeeneticBackend) post(commands []any) ([]json.RawMessage, error) {
+	payload, err := json.Marshal(commands)
+	if err != nil {
+		return nil, err
+	}
+	response, err := httpClient.Post(b.rciURL(), "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к RCI: %v", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения ответа RCI: %v", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("RCI вернул статус %d", response.StatusCode)
+	}
+
+	var responses []json.RawMessage
+	if err = json.Unmarshal(body, &responses); err != nil {
+		return nil, fmt.Errorf("ошибка разбора ответа RCI: %v", err)
+	}
+	if len(responses) != len(commands) {
+		return nil, fmt.Errorf("RCI вернул %d ответов на %d команд", len(responses), len(commands))
+	}
+	return responses, nil
+}
+
+func (b *KeeneticBackend) rciURL() string {
+	if b.RciURL == "" {
+		return DefaultRciURL
+	}
+	if !strings.HasSuffix(b.RciURL, "/") {
+		return b.RciURL + "/"
+	}
+	return b.RciURL
+}
+
+// rciError ищет в ответе на команду статусы с ошибкой и возвращает их текст.
+// Статусы вложены в ответ по пути команды, например ip.route.status.
+func rciError(response json.RawMessage) string {
+	var value any
+	if err := json.Unmarshal(response, &value); err != nil {
+		return fmt.Sprintf("некорректный ответ RCI: %v", err)
+	}
+
+	var messages []string
+	var walk func(value any)
+	walk = func(value any) {
+		switch v := value.(type) {
+		case map[string]any:
+			if v["status"] == "error" {
+				message, _ := v["message"].(string)
+				messages = append(messages, message)
+			}
+			for _, item := range v {
+				walk(item)
+			}
+		case []any:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(value)
+	return strings.Join(messages, "; ")
+}
+
+// isMissingRoute сообщает, что удаляемого маршрута уже нет в конфигурации
+func isMissingRoute(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "no such") || strings.Contains(message, "not found")
+}
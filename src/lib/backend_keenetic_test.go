@@ -0,0 +1,124 @@
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// keeneticStandIn - заглушка RCI API, которая хранит статические маршруты IPv4,
+// а IPv6 маршрутов у нее нет
+type keeneticStandIn struct {
+	routes []keeneticRoute
+	saves  int
+}
+
+func (s *keeneticStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.URL.Path == "/rci/ip/route" {
+		json.NewEncoder(w).Encode(s.routes)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/rci/ipv6/route" {
+		w.Write([]byte("{}"))
+		return
+	}
+	if r.Method != http.MethodPost || r.URL.Path != "/rci/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var commands []struct {
+		IP *struct {
+			Route keeneticRoute `json:"route"`
+		} `json:"ip"`
+		System json.RawMessage `json:"system"`
+	}
+	json.NewDecoder(r.Body).Decode(&commands)
+
+	var responses []any
+	for _, command := range commands {
+		if command.System != nil {
+			s.saves++
+			responses = append(responses, map[string]any{})
+			continue
+		}
+		route := command.IP.Route
+		status := map[string]any{"status": "message", "message": "ok"}
+		if route.No {
+			found := false
+			for i, other := range s.routes {
+				if other.Network == route.Network && other.Mask == route.Mask {
+					s.routes = append(s.routes[:i], s.routes[i+1:]...)
+					found = true
+					break
+				}
+			}
+			if !found {
+				status = map[string]any{"status": "error", "message": "no such route"}
+			}
+		} else if route.Interface == "Missing0" {
+			status = map[string]any{"status": "error", "message": "unable to find Missing0"}
+		} else {
+			s.routes = append(s.routes, route)
+		}
+		responses = append(responses, map[string]any{"ip": map[string]any{"route": map[string]any{"status": []any{status}}}})
+	}
+	json.NewEncoder(w).Encode(responses)
+}
+
+// Тест для KeeneticBackend с заглушкой RCI API
+func TestKeeneticBackend(t *testing.T) {
+	standIn := &keeneticStandIn{routes: []keeneticRoute{
+		{Network: "192.168.0.0", Mask: "255.255.0.0", Interface: "Wireguard0", Comment: "вручную"},
+	}}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	b := &KeeneticBackend{RouteOptions{Interface: "Wireguard0", RciURL: server.URL + "/rci", Comment: "routing_ripe:ru"}}
+
+	results, err := b.Add([]string{"5.8.0.0/16", "5.9.1.1/32", "bad"})
+	if err != nil {
+		t.Fatalf("Ошибка Add: %v", err)
+	}
+	if results[0].Err != nil || results[1].Err != nil || results[2].Err == nil {
+		t.Errorf("Add() = %v", results)
+	}
+	expected := keeneticRoute{Network: "5.8.0.0", Mask: "255.255.0.0", Interface: "Wireguard0", Auto: true, Comment: "routing_ripe:ru"}
+	if standIn.routes[1] != expected {
+		t.Errorf("маршрут RCI = %+v; ожидается %+v", standIn.routes[1], expected)
+	}
+
+	// Маршрут, добавленный вручную, не попадает в список
+	subnets, err := b.List()
+	if err != nil {
+		t.Fatalf("Ошибка List: %v", err)
+	}
+	if !reflect.DeepEqual(subnets, []string{"5.8.0.0/16", "5.9.1.1/32"}) {
+		t.Errorf("List() = %v; ожидается [5.8.0.0/16 5.9.1.1/32]", subnets)
+	}
+
+	// Удаление отсутствующего маршрута не ошибка
+	results, err = b.Delete([]string{"5.8.0.0/16", "10.0.0.0/8"})
+	if err != nil || results[0].Err != nil || results[1].Err != nil {
+		t.Errorf("Delete() = %v, %v", results, err)
+	}
+
+	if err = b.Flush(); err != nil {
+		t.Fatalf("Ошибка Flush: %v", err)
+	}
+	if len(standIn.routes) != 1 || standIn.routes[0].Comment != "вручную" {
+		t.Errorf("после Flush остались маршруты %+v", standIn.routes)
+	}
+	if standIn.saves != 3 {
+		t.Errorf("конфигурация сохранена %d раз; ожидается 3", standIn.saves)
+	}
+
+	// Ошибка команды относится к своей подсети
+	b.Interface = "Missing0"
+	results, err = b.Add([]string{"5.8.0.0/16"})
+	if err != nil || results[0].Err == nil || results[0].Err.Error() != "unable to find Missing0" {
+		t.Errorf("Add() = %v, %v; ожидается ошибка интерфейса", results, err)
+	}
+}
@@ -0,0 +1,48 @@
+package lib
+
+// NetlinkBackend устанавливает маршруты напрямую через rtnetlink пакетами
+type NetlinkBackend struct {
+	RouteOptions
+}
+
+func (b *NetlinkBackend) Name() string { return "netlink" }
+
+// Add добавляет маршруты для подсетей
+func (b *NetlinkBackend) Add(subnets []string) ([]RouteResult, error) {
+	return runByFamily(subnets, func(subnets []string, v6 bool) ([]RouteResult, error) {
+		return netlinkRoutes(subnets, b.RouteOptions, v6, true)
+	})
+}
+
+// Delete удаляет маршруты для подсетей
+func (b *NetlinkBackend) Delete(subnets []string) ([]RouteResult, error) {
+	return runByFamily(subnets, func(subnets []string, v6 bool) ([]RouteResult, error) {
+		return netlinkRoutes(subnets, b.RouteOptions, v6, false)
+	})
+}
+
+// List возвращает статические маршруты (proto boot) через интерфейс или шлюз
+func (b *NetlinkBackend) List() ([]string, error) {
+	var subnets []string
+	for _, v6 := range []bool{false, true} {
+		if !b.configured(v6) {
+			continue
+		}
+		familySubnets, err := netlinkListRoutes(b.RouteOptions, v6)
+		if err != nil {
+			return nil, err
+		}
+		subnets = append(subnets, familySubnets...)
+	}
+	return subnets, nil
+}
+
+// Flush удаляет все маршруты, которые возвращает List
+func (b *NetlinkBackend) Flush() error {
+	subnets, err := b.List()
+	if err != nil {
+		return err
+	}
+	_, err = b.Delete(subnets)
+	return err
+}
@@ -0,0 +1,264 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/Max121279/routing_ripe/src/lib/cidrset"
+)
+
+// DefaultNftTable - таблица nftables для наборов по умолчанию
+const DefaultNftTable = "inet routing_ripe"
+
+// NftBackend заполняет именованные наборы nftables вместо таблицы маршрутов.
+// IPv4 подсети попадают в набор SetName, IPv6 - в SetName_v6. Все изменения
+// выполняются одной транзакцией `nft -f`, поэтому набор меняется атомарно.
+type NftBackend struct {
+	RouteOptions
+}
+
+func (b *NftBackend) Name() string { return "nftables" }
+
+// Add добавляет подсети в наборы, создавая таблицу и наборы при необходимости
+func (b *NftBackend) Add(subnets []string) ([]RouteResult, error) {
+	return runByFamily(subnets, func(subnets []string, v6 bool) ([]RouteResult, error) {
+		results, valid := checkSubnets(subnets)
+		script, err := b.setScript(valid, v6, false)
+		if err != nil {
+			return nil, err
+		}
+		return results, nftRun(script)
+	})
+}
+
+// Delete удаляет подсети из наборов. Удаление отсутствующего элемента
+// прервало бы транзакцию, поэтому удаляются только имеющиеся в наборе.
+func (b *NftBackend) Delete(subnets []string) ([]RouteResult, error) {
+	return runByFamily(subnets, func(subnets []string, v6 bool) ([]RouteResult, error) {
+		results, valid := checkSubnets(subnets)
+		installed, exists, err := b.listSet(v6)
+		if err != nil || !exists {
+			return results, err
+		}
+		var present []string
+		for _, subnet := range valid {
+			if slices.Contains(installed, subnet) {
+				present = append(present, subnet)
+			}
+		}
+		if len(present) == 0 {
+			return results, nil
+		}
+		family, table, _ := b.nftTable()
+		script := fmt.Sprintf("delete element %s %s %s { %s }\n", family, table, b.setName(v6), strings.Join(present, ", "))
+		return results, nftRun(script)
+	})
+}
+
+// List возвращает подсети из наборов профиля
+func (b *NftBackend) List() ([]string, error) {
+	var subnets []string
+	for _, v6 := range []bool{false, true} {
+		familySubnets, _, err := b.listSet(v6)
+		if err != nil {
+			return nil, err
+		}
+		subnets = append(subnets, familySubnets...)
+	}
+	return subnets, nil
+}
+
+// Flush очищает наборы профиля
+func (b *NftBackend) Flush() error {
+	family, table, err := b.nftTable()
+	if err != nil {
+		return err
+	}
+	var script strings.Builder
+	for _, v6 := range []bool{false, true} {
+		_, exists, err := b.listSet(v6)
+		if err != nil {
+			return err
+		}
+		if exists {
+			fmt.Fprintf(&script, "flush set %s %s %s\n", family, table, b.setName(v6))
+		}
+	}
+	return nftRun(script.String())
+}
+
+// Replace заменяет содержимое наборов одной транзакцией: очистка и загрузка
+// новых подсетей применяются вместе, промежуточное состояние не видно
+func (b *NftBackend) Replace(subnets []string) error {
+	results, _ := checkSubnets(subnets)
+	for _, result := range results {
+		if result.Err != nil {
+			return fmt.Errorf("%s: %v", result.Subnet, result.Err)
+		}
+	}
+
+	v4, v6 := splitByFamily(subnets)
+	script, err := b.setScript(v4, false, true)
+	if err != nil {
+		return err
+	}
+	// IPv6 набор заменяется, только если есть IPv6 подсети или он уже существует
+	_, exists, err := b.listSet(true)
+	if err != nil {
+		return err
+	}
+	if len(v6) > 0 || exists {
+		v6Script, err := b.setScript(v6, true, true)
+		if err != nil {
+			return err
+		}
+		script += v6Script
+	}
+	return nftRun(script)
+}
+
+// setScript составляет команды nft для добавления подсетей в набор.
+// Таблица и набор создаются, если их нет; replace очищает набор перед загрузкой.
+func (b *NftBackend) setScript(subnets []string, v6, replace bool) (string, error) {
+	family, table, err := b.nftTable()
+	if err != nil {
+		return "", err
+	}
+	addrType := "ipv4_addr"
+	if v6 {
+		addrType = "ipv6_addr"
+	}
+	name := b.setName(v6)
+
+	var script strings.Builder
+	fmt.Fprintf(&script, "add table %s %s\n", family, table)
+	fmt.Fprintf(&script, "add set %s %s %s { type %s; flags interval; }\n", family, table, name, addrType)
+	if replace {
+		fmt.Fprintf(&script, "flush set %s %s %s\n", family, table, name)
+	}
+	if len(subnets) > 0 {
+		fmt.Fprintf(&script, "add element %s %s %s { %s }\n", family, table, name, strings.Join(subnets, ", "))
+	}
+	return script.String(), nil
+}
+
+// listSet возвращает подсети набора и признак его существования
+func (b *NftBackend) listSet(v6 bool) ([]string, bool, error) {
+	family, table, err := b.nftTable()
+	if err != nil {
+		return nil, false, err
+	}
+	output, err := exec.Command("nft", "-j", "list", "set", family, table, b.setName(v6)).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(output), "No such file or directory") {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("ошибка чтения набора nftables %s: %s", b.setName(v6), strings.TrimSpace(string(output)))
+	}
+	subnets, err := parseNftSet(output)
+	if err != nil {
+		return nil, false, err
+	}
+	return subnets, true, nil
+}
+
+// nftTable разбирает NftTable вида "inet routing_ripe" на семейство и имя
+func (o RouteOptions) nftTable() (family, table string, err error) {
+	fields := strings.Fields(o.NftTable)
+	if len(fields) != 2 || !slices.Contains([]string{"ip", "ip6", "inet"}, fields[0]) {
+		return "", "", fmt.Errorf("некорректная таблица nftables %q, ожидается \"inet имя\"", o.NftTable)
+	}
+	return fields[0], fields[1], nil
+}
+
+// nftRun выполняет команды одной транзакцией `nft -f -`
+func nftRun(script string) error {
+	if script == "" {
+		return nil
+	}
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ошибка nft: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// parseNftSet извлекает подсети из вывода `nft -j list set`. Элементы
+// бывают адресами, префиксами и диапазонами; диапазоны раскладываются на префиксы.
+func parseNftSet(output []byte) ([]string, error) {
+	var dump struct {
+		Nftables []struct {
+			Set *struct {
+				Elem []json.RawMessage `json:"elem"`
+			} `json:"set"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal(output, &dump); err != nil {
+		return nil, fmt.Errorf("ошибка разбора вывода nft: %v", err)
+	}
+
+	var subnets []string
+	for _, item := range dump.Nftables {
+		if item.Set == nil {
+			continue
+		}
+		for _, raw := range item.Set.Elem {
+			elemSubnets, err := parseNftElem(raw)
+			if err != nil {
+				return nil, err
+			}
+			subnets = append(subnets, elemSubnets...)
+		}
+	}
+	return subnets, nil
+}
+
+// parseNftElem разбирает один элемент набора nftables в JSON
+func parseNftElem(raw json.RawMessage) ([]string, error) {
+	var addr string
+	if json.Unmarshal(raw, &addr) == nil {
+		return []string{hostPrefix(addr)}, nil
+	}
+
+	var elem struct {
+		Prefix *struct {
+			Addr string `json:"addr"`
+			Len  int    `json:"len"`
+		} `json:"prefix"`
+		Range []string `json:"range"`
+		// Элемент с таймаутом или комментарием вложен в elem.val
+		Elem *struct {
+			Val json.RawMessage `json:"val"`
+		} `json:"elem"`
+	}
+	if err := json.Unmarshal(raw, &elem); err != nil {
+		return nil, fmt.Errorf("неизвестный элемент набора nftables %s", raw)
+	}
+	switch {
+	case elem.Prefix != nil:
+		return []string{fmt.Sprintf("%s/%d", elem.Prefix.Addr, elem.Prefix.Len)}, nil
+	case len(elem.Range) == 2:
+		from, err := netip.ParseAddr(elem.Range[0])
+		if err != nil {
+			return nil, fmt.Errorf("некорректный диапазон %v: %v", elem.Range, err)
+		}
+		to, err := netip.ParseAddr(elem.Range[1])
+		if err != nil {
+			return nil, fmt.Errorf("некорректный диапазон %v: %v", elem.Range, err)
+		}
+		set, err := cidrset.FromRange(from, to)
+		if err != nil {
+			return nil, err
+		}
+		return set.Strings(), nil
+	case elem.Elem != nil:
+		return parseNftElem(elem.Elem.Val)
+	}
+	return nil, fmt.Errorf("неизвестный элемент набора nftables %s", raw)
+}
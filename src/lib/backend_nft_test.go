@@ -0,0 +1,46 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Тест для parseNftSet: адреса, префиксы, диапазоны и элементы с комментарием
+func TestParseNftSet(t *testing.T) {
+	output := `{"nftables": [{"metainfo": {"json_schema_version": 1}},
+		{"set": {"family": "inet", "name": "ripe_ru", "table": "routing_ripe", "type": "ipv4_addr", "flags": ["interval"],
+		"elem": ["5.9.1.1", {"prefix": {"addr": "5.8.0.0", "len": 16}}, {"range": ["10.0.0.0", "10.0.2.255"]},
+		{"elem": {"val": {"prefix": {"addr": "2a00:1::", "len": 32}}, "comment": "ru"}}]}}]}`
+
+	expected := []string{"5.9.1.1/32", "5.8.0.0/16", "10.0.0.0/23", "10.0.2.0/24", "2a00:1::/32"}
+	result, err := parseNftSet([]byte(output))
+	if err != nil {
+		t.Fatalf("Ошибка parseNftSet: %v", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("parseNftSet() = %v; ожидается %v", result, expected)
+	}
+}
+
+// Тест для NftBackend.setScript
+func TestNftSetScript(t *testing.T) {
+	b := &NftBackend{RouteOptions{SetName: "ripe_ru", NftTable: DefaultNftTable}}
+	script, err := b.setScript([]string{"2a00:1::/32", "2a01::/16"}, true, true)
+	if err != nil {
+		t.Fatalf("Ошибка setScript: %v", err)
+	}
+	expected := "add table inet routing_ripe\n" +
+		"add set inet routing_ripe ripe_ru_v6 { type ipv6_addr; flags interval; }\n" +
+		"flush set inet routing_ripe ripe_ru_v6\n" +
+		"add element inet routing_ripe ripe_ru_v6 { 2a00:1::/32, 2a01::/16 }\n"
+	if script != expected {
+		t.Errorf("setScript() = %q; ожидается %q", script, expected)
+	}
+
+	for _, table := range []string{"", "routing_ripe", "bridge routing_ripe"} {
+		b.NftTable = table
+		if _, err = b.setScript(nil, false, false); err == nil {
+			t.Errorf("setScript с таблицей %q должна вернуть ошибку", table)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package lib
+
+import "sort"
+
+// RecordedCall - вызов, записанный RecordingBackend
+type RecordedCall struct {
+	Op      string
+	Subnets []string
+}
+
+// RecordingBackend хранит маршруты в памяти и записывает все вызовы.
+// Используется в тестах вместо настоящей таблицы маршрутов.
+type RecordingBackend struct {
+	Routes map[string]bool
+	Calls  []RecordedCall
+	// Errors позволяет вернуть ошибку для конкретной подсети
+	Errors map[string]error
+}
+
+// NewRecordingBackend создает фейковый бэкенд с уже установленными маршрутами
+func NewRecordingBackend(installed ...string) *RecordingBackend {
+	b := &RecordingBackend{Routes: make(map[string]bool)}
+	for _, subnet := range installed {
+		b.Routes[subnet] = true
+	}
+	return b
+}
+
+func (b *RecordingBackend) Name() string { return "recording" }
+
+func (b *RecordingBackend) Add(subnets []string) ([]RouteResult, error) {
+	b.Calls = append(b.Calls, RecordedCall{Op: "add", Subnets: subnets})
+	return b.apply(subnets, true), nil
+}
+
+func (b *RecordingBackend) Delete(subnets []string) ([]RouteResult, error) {
+	b.Calls = append(b.Calls, RecordedCall{Op: "del", Subnets: subnets})
+	return b.apply(subnets, false), nil
+}
+
+func (b *RecordingBackend) List() ([]string, error) {
+	b.Calls = append(b.Calls, RecordedCall{Op: "list"})
+	subnets := make([]string, 0, len(b.Routes))
+	for subnet := range b.Routes {
+		subnets = append(subnets, subnet)
+	}
+	sort.Strings(subnets)
+	return subnets, nil
+}
+
+func (b *RecordingBackend) Flush() error {
+	b.Calls = append(b.Calls, RecordedCall{Op: "flush"})
+	b.Routes = make(map[string]bool)
+	return nil
+}
+
+func (b *RecordingBackend) apply(subnets []string, add bool) []RouteResult {
+	results := make([]RouteResult, len(subnets))
+	for i, subnet := range subnets {
+		results[i] = RouteResult{Subnet: subnet, Err: b.Errors[subnet]}
+		if results[i].Err != nil {
+			continue
+		}
+		if add {
+			b.Routes[subnet] = true
+		} else {
+			delete(b.Routes, subnet)
+		}
+	}
+	return results
+}
@@ -0,0 +1,45 @@
+package lib
+
+import "github.com/Max121279/routing_ripe/src/lib/cidrset"
+
+// Специальные диапазоны IPv4, которые не относятся к публичному юникасту
+// (RFC 6890 и смежные)
+var specialIPv4 = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.88.99.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+}
+
+// Специальные диапазоны внутри глобального юникаста IPv6 2000::/3
+var specialIPv6 = []string{
+	"2001::/23",
+	"2001:db8::/32",
+	"2002::/16",
+	"3fff::/20",
+}
+
+// PublicUnicast возвращает публичное юникаст-пространство IPv4 и, если
+// задано ipv6, IPv6. Используется для инверсии набора стран.
+func PublicUnicast(ipv6 bool) *cidrset.Set {
+	public, _ := cidrset.Parse("0.0.0.0/0")
+	special, _ := cidrset.Parse(specialIPv4...)
+	if ipv6 {
+		global, _ := cidrset.Parse("2000::/3")
+		public = public.Union(global)
+		specialV6, _ := cidrset.Parse(specialIPv6...)
+		special = special.Union(specialV6)
+	}
+	return public.Subtract(special)
+}
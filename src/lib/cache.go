@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultCacheMaxAge - сколько по умолчанию можно использовать кэш при недоступности RIPEstat
+const DefaultCacheMaxAge = 7 * 24 * time.Hour
+
+// Cache хранит успешные ответы RIPEstat и файлы источников в отдельных файлах
+type Cache struct {
+	Dir    string
+	MaxAge time.Duration
+}
+
+// CachedResponse - сохраненный ответ вместе с временем получения. Тело
+// хранится в base64, так как файлы delegated и базы mmdb - не JSON.
+type CachedResponse struct {
+	URL       string    `json:"url"`
+	FetchedAt time.Time `json:"fetched_at"`
+	QueryTime string    `json:"query_time"`
+	Body      []byte    `json:"body"`
+}
+
+// Save сохраняет ответ в кэш. Файл записывается атомарно через переименование.
+func (c *Cache) Save(url string, body []byte, queryTime string) error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return fmt.Errorf("ошибка создания каталога кэша: %v", err)
+	}
+
+	data, err := json.Marshal(CachedResponse{
+		URL:       url,
+		FetchedAt: time.Now(),
+		QueryTime: queryTime,
+		Body:      body,
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации кэша: %v", err)
+	}
+
+	path := c.path(url)
+	if err = os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("ошибка записи кэша: %v", err)
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("ошибка записи кэша: %v", err)
+	}
+	return nil
+}
+
+// Load возвращает сохраненный ответ, если он не старше MaxAge
+func (c *Cache) Load(url string) (*CachedResponse, error) {
+	data, err := os.ReadFile(c.path(url))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения кэша: %v", err)
+	}
+
+	var cached CachedResponse
+	if err = json.Unmarshal(data, &cached); err != nil {
+		return nil, fmt.Errorf("ошибка разбора кэша: %v", err)
+	}
+	if age := time.Since(cached.FetchedAt); age > c.MaxAge {
+		return nil, fmt.Errorf("кэш устарел: получен %s назад, допустимо %s", age.Round(time.Minute), c.MaxAge)
+	}
+
+	return &cached, nil
+}
+
+// path возвращает имя файла кэша для URL
+func (c *Cache) path(url string) string {
+	sum := sha1.Sum([]byte(url))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:])+".json")
+}
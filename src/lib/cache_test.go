@@ -0,0 +1,34 @@
+package lib
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// Тест для Cache: ответы, которые не являются JSON, сохраняются без изменений
+func TestCacheSaveLoad(t *testing.T) {
+	cache := &Cache{Dir: t.TempDir(), MaxAge: time.Hour}
+
+	tests := []struct {
+		url  string
+		body []byte
+	}{
+		{"https://stat.ripe.net/data/country-resource-list/data.json?resource=RU", []byte(`{"status":"ok"}`)},
+		{"https://ftp.ripe.net/pub/stats/ripencc/delegated-ripencc-extended-latest", []byte("2|ripencc|1700000000|5\nripencc|RU|ipv4|2.56.0.0|1024|20190101|allocated|a1\n")},
+		{"https://example.net/GeoLite2-Country.mmdb", []byte("\x00\xff\xab\xcd\xefMaxMind.com\xe1\x01")},
+	}
+
+	for _, test := range tests {
+		if err := cache.Save(test.url, test.body, "2024-01-01T00:00:00"); err != nil {
+			t.Fatalf("Ошибка Save(%s): %v", test.url, err)
+		}
+		cached, err := cache.Load(test.url)
+		if err != nil {
+			t.Fatalf("Ошибка Load(%s): %v", test.url, err)
+		}
+		if !bytes.Equal(cached.Body, test.body) || cached.QueryTime != "2024-01-01T00:00:00" {
+			t.Errorf("Load(%s) = %q; ожидается %q", test.url, cached.Body, test.body)
+		}
+	}
+}
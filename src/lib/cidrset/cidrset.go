@@ -0,0 +1,313 @@
+// Package cidrset реализует множество IP-адресов на основе netip.Prefix.
+//
+// Множество хранится как отсортированный список непересекающихся диапазонов
+// адресов, поэтому объединение, вычитание и пересечение выполняются за
+// линейное время, а результат всегда сводится к минимальному набору префиксов.
+package cidrset
+
+import (
+	"fmt"
+	"iter"
+	"math/big"
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// addrRange - непрерывный диапазон адресов одного семейства [from, to]
+type addrRange struct {
+	from, to netip.Addr
+}
+
+// Set - множество адресов IPv4 и IPv6. Операции не изменяют множество,
+// а возвращают новое. Нулевое значение и nil - пустое множество.
+type Set struct {
+	// ranges отсортированы, не пересекаются и не соприкасаются;
+	// все диапазоны IPv4 идут раньше IPv6
+	ranges []addrRange
+}
+
+// New создает множество из префиксов
+func New(prefixes ...netip.Prefix) *Set {
+	ranges := make([]addrRange, 0, len(prefixes))
+	for _, p := range prefixes {
+		if !p.IsValid() {
+			continue
+		}
+		p = normalizePrefix(p)
+		ranges = append(ranges, addrRange{p.Addr(), lastAddr(p)})
+	}
+	return fromRanges(ranges)
+}
+
+// FromRange создает множество из диапазона адресов from-to включительно
+func FromRange(from, to netip.Addr) (*Set, error) {
+	from, to = from.Unmap(), to.Unmap()
+	if !from.IsValid() || !to.IsValid() || from.BitLen() != to.BitLen() || from.Compare(to) > 0 {
+		return nil, fmt.Errorf("некорректный диапазон адресов: %s - %s", from, to)
+	}
+	return &Set{ranges: []addrRange{{from, to}}}, nil
+}
+
+// Parse создает множество из строк вида "a.b.c.d/n", "a.b.c.d" или
+// "a.b.c.d-e.f.g.h" (и аналогичных для IPv6)
+func Parse(values ...string) (*Set, error) {
+	var ranges []addrRange
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		switch {
+		case strings.Contains(value, "-"):
+			parts := strings.SplitN(value, "-", 2)
+			from, err := netip.ParseAddr(strings.TrimSpace(parts[0]))
+			if err != nil {
+				return nil, fmt.Errorf("ошибка разбора диапазона %s: %v", value, err)
+			}
+			to, err := netip.ParseAddr(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, fmt.Errorf("ошибка разбора диапазона %s: %v", value, err)
+			}
+			set, err := FromRange(from, to)
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, set.ranges...)
+		case strings.Contains(value, "/"):
+			p, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("ошибка разбора подсети %s: %v", value, err)
+			}
+			p = normalizePrefix(p)
+			ranges = append(ranges, addrRange{p.Addr(), lastAddr(p)})
+		default:
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("ошибка разбора адреса %s: %v", value, err)
+			}
+			addr = addr.Unmap()
+			ranges = append(ranges, addrRange{addr, addr})
+		}
+	}
+	return fromRanges(ranges), nil
+}
+
+// Union возвращает объединение множеств
+func (s *Set) Union(other *Set) *Set {
+	ranges := make([]addrRange, 0, s.numRanges()+other.numRanges())
+	ranges = append(ranges, s.rangeList()...)
+	ranges = append(ranges, other.rangeList()...)
+	return fromRanges(ranges)
+}
+
+// Subtract возвращает адреса s, не входящие в other
+func (s *Set) Subtract(other *Set) *Set {
+	cut := other.rangeList()
+	var result []addrRange
+	j := 0
+	for _, r := range s.rangeList() {
+		for j < len(cut) && cut[j].to.Compare(r.from) < 0 {
+			j++
+		}
+		keep := true
+		for k := j; k < len(cut) && cut[k].from.Compare(r.to) <= 0; k++ {
+			if cut[k].from.Compare(r.from) > 0 {
+				result = append(result, addrRange{r.from, cut[k].from.Prev()})
+			}
+			if cut[k].to.Compare(r.to) >= 0 {
+				keep = false
+				break
+			}
+			r.from = cut[k].to.Next()
+		}
+		if keep {
+			result = append(result, r)
+		}
+	}
+	return &Set{ranges: result}
+}
+
+// SubtractPrefix возвращает множество без адресов префикса
+func (s *Set) SubtractPrefix(p netip.Prefix) *Set {
+	return s.Subtract(New(p))
+}
+
+// SubtractAddr возвращает множество без одного адреса
+func (s *Set) SubtractAddr(addr netip.Addr) *Set {
+	addr = addr.Unmap()
+	return s.Subtract(&Set{ranges: []addrRange{{addr, addr}}})
+}
+
+// Intersect возвращает пересечение множеств
+func (s *Set) Intersect(other *Set) *Set {
+	a, b := s.rangeList(), other.rangeList()
+	var result []addrRange
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		from, to := a[i].from, a[i].to
+		if b[j].from.Compare(from) > 0 {
+			from = b[j].from
+		}
+		if b[j].to.Compare(to) < 0 {
+			to = b[j].to
+		}
+		if from.Compare(to) <= 0 {
+			result = append(result, addrRange{from, to})
+		}
+		if a[i].to.Compare(b[j].to) < 0 {
+			i++
+		} else {
+			j++
+		}
+	}
+	return &Set{ranges: result}
+}
+
+// Contains сообщает, входит ли адрес в множество
+func (s *Set) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	ranges := s.rangeList()
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].to.Compare(addr) >= 0 })
+	return i < len(ranges) && ranges[i].from.Compare(addr) <= 0
+}
+
+// ContainsPrefix сообщает, входит ли префикс в множество целиком
+func (s *Set) ContainsPrefix(p netip.Prefix) bool {
+	p = normalizePrefix(p)
+	ranges := s.rangeList()
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].to.Compare(p.Addr()) >= 0 })
+	return i < len(ranges) && ranges[i].from.Compare(p.Addr()) <= 0 && ranges[i].to.Compare(lastAddr(p)) >= 0
+}
+
+// Overlaps сообщает, есть ли у префикса общие адреса с множеством
+func (s *Set) Overlaps(p netip.Prefix) bool {
+	return !s.Intersect(New(p)).IsEmpty()
+}
+
+// IsEmpty сообщает, что множество пустое
+func (s *Set) IsEmpty() bool {
+	return s.numRanges() == 0
+}
+
+// All перебирает минимальный набор префиксов множества в порядке адресов
+func (s *Set) All() iter.Seq[netip.Prefix] {
+	return func(yield func(netip.Prefix) bool) {
+		for _, r := range s.rangeList() {
+			for p := range rangePrefixes(r) {
+				if !yield(p) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Prefixes возвращает минимальный набор префиксов множества (агрегация)
+func (s *Set) Prefixes() []netip.Prefix {
+	return slices.Collect(s.All())
+}
+
+// Strings возвращает префиксы множества в строковом виде
+func (s *Set) Strings() []string {
+	var result []string
+	for p := range s.All() {
+		result = append(result, p.String())
+	}
+	return result
+}
+
+// Count возвращает количество адресов в множестве
+func (s *Set) Count() *big.Int {
+	total := new(big.Int)
+	for _, r := range s.rangeList() {
+		size := new(big.Int).Sub(addrInt(r.to), addrInt(r.from))
+		total.Add(total, size.Add(size, big.NewInt(1)))
+	}
+	return total
+}
+
+func (s *Set) rangeList() []addrRange {
+	if s == nil {
+		return nil
+	}
+	return s.ranges
+}
+
+func (s *Set) numRanges() int {
+	return len(s.rangeList())
+}
+
+// fromRanges сортирует диапазоны и склеивает пересекающиеся и соседние
+func fromRanges(ranges []addrRange) *Set {
+	slices.SortFunc(ranges, func(a, b addrRange) int { return a.from.Compare(b.from) })
+
+	var result []addrRange
+	for _, r := range ranges {
+		if n := len(result); n > 0 && touches(result[n-1], r) {
+			if r.to.Compare(result[n-1].to) > 0 {
+				result[n-1].to = r.to
+			}
+			continue
+		}
+		result = append(result, r)
+	}
+	return &Set{ranges: result}
+}
+
+// touches сообщает, что диапазон b (начинающийся не раньше a) пересекается
+// с a или продолжает его без разрыва
+func touches(a, b addrRange) bool {
+	if b.from.Compare(a.to) <= 0 {
+		return true
+	}
+	next := a.to.Next()
+	return next.IsValid() && next == b.from
+}
+
+// rangePrefixes перебирает минимальный набор префиксов, покрывающих диапазон
+func rangePrefixes(r addrRange) iter.Seq[netip.Prefix] {
+	return func(yield func(netip.Prefix) bool) {
+		from := r.from
+		for {
+			// Ищем самый крупный блок, который начинается с from и не выходит за to
+			p := netip.PrefixFrom(from, from.BitLen())
+			for bits := from.BitLen() - 1; bits >= 0; bits-- {
+				q := netip.PrefixFrom(from, bits)
+				if q.Masked().Addr() != from || lastAddr(q).Compare(r.to) > 0 {
+					break
+				}
+				p = q
+			}
+			if !yield(p) {
+				return
+			}
+			last := lastAddr(p)
+			if last == r.to {
+				return
+			}
+			from = last.Next()
+		}
+	}
+}
+
+// normalizePrefix приводит префикс к каноническому виду:
+// адрес сети без хостовой части, IPv4 без отображения в IPv6
+func normalizePrefix(p netip.Prefix) netip.Prefix {
+	if p.Addr().Is4In6() && p.Bits() >= 96 {
+		p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	return p.Masked()
+}
+
+// lastAddr возвращает последний адрес префикса
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// addrInt возвращает адрес в виде целого числа
+func addrInt(addr netip.Addr) *big.Int {
+	return new(big.Int).SetBytes(addr.AsSlice())
+}
@@ -0,0 +1,118 @@
+package cidrset
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func mustParse(t *testing.T, values ...string) *Set {
+	t.Helper()
+	set, err := Parse(values...)
+	if err != nil {
+		t.Fatalf("Ошибка Parse(%v): %v", values, err)
+	}
+	return set
+}
+
+// Тест для агрегации при построении множества
+func TestParseAggregates(t *testing.T) {
+	tests := []struct {
+		values   []string
+		expected []string
+	}{
+		{[]string{"192.168.0.0/24", "192.168.1.0/24"}, []string{"192.168.0.0/23"}},
+		{[]string{"10.0.0.0/28", "10.0.0.16/28"}, []string{"10.0.0.0/27"}},
+		{[]string{"10.0.0.1/32", "10.0.0.2/32"}, []string{"10.0.0.1/32", "10.0.0.2/32"}},
+		{[]string{"10.0.0.0/8", "10.1.0.0/16"}, []string{"10.0.0.0/8"}},
+		{[]string{"10.0.0.0-10.0.1.255"}, []string{"10.0.0.0/23"}},
+		{[]string{"10.0.0.3-10.0.0.17"}, []string{"10.0.0.3/32", "10.0.0.4/30", "10.0.0.8/29", "10.0.0.16/31"}},
+		{[]string{"2001:db8::/33", "10.0.0.5", "2001:db8:8000::/33"}, []string{"10.0.0.5/32", "2001:db8::/32"}},
+		{[]string{"255.255.255.255/32", "::/128"}, []string{"255.255.255.255/32", "::/128"}},
+	}
+
+	for _, test := range tests {
+		result := mustParse(t, test.values...).Strings()
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Parse(%v) = %v; ожидается %v", test.values, result, test.expected)
+		}
+	}
+}
+
+// Тест для Subtract
+func TestSubtract(t *testing.T) {
+	tests := []struct {
+		set      []string
+		cut      []string
+		expected []string
+	}{
+		{
+			set: []string{"10.0.0.0/8"},
+			cut: []string{"10.134.1.24"},
+			expected: []string{
+				"10.0.0.0/9", "10.128.0.0/14", "10.132.0.0/15", "10.134.0.0/24",
+				"10.134.1.0/28", "10.134.1.16/29", "10.134.1.25/32", "10.134.1.26/31",
+				"10.134.1.28/30", "10.134.1.32/27", "10.134.1.64/26", "10.134.1.128/25",
+				"10.134.2.0/23", "10.134.4.0/22", "10.134.8.0/21", "10.134.16.0/20",
+				"10.134.32.0/19", "10.134.64.0/18", "10.134.128.0/17", "10.135.0.0/16",
+				"10.136.0.0/13", "10.144.0.0/12", "10.160.0.0/11", "10.192.0.0/10",
+			},
+		},
+		{
+			set:      []string{"192.168.0.0/30"},
+			cut:      []string{"192.168.0.1", "192.168.0.3"},
+			expected: []string{"192.168.0.0/32", "192.168.0.2/32"},
+		},
+		{
+			set:      []string{"10.0.0.0/24", "10.0.2.0/24"},
+			cut:      []string{"10.0.0.128/25", "10.0.1.0/24", "10.0.2.0/25"},
+			expected: []string{"10.0.0.0/25", "10.0.2.128/25"},
+		},
+		{
+			set:      []string{"10.0.0.0/24", "2001:db8::/32"},
+			cut:      []string{"0.0.0.0/0"},
+			expected: []string{"2001:db8::/32"},
+		},
+	}
+
+	for _, test := range tests {
+		result := mustParse(t, test.set...).Subtract(mustParse(t, test.cut...)).Strings()
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Subtract(%v, %v) = %v; ожидается %v", test.set, test.cut, result, test.expected)
+		}
+	}
+}
+
+// Тест для Intersect
+func TestIntersect(t *testing.T) {
+	a := mustParse(t, "10.0.0.0/16", "192.168.0.0/24", "2001:db8::/32")
+	b := mustParse(t, "10.0.255.0/24", "10.1.0.0/16", "192.168.0.128/25", "2001:db8:1::/48")
+
+	expected := []string{"10.0.255.0/24", "192.168.0.128/25", "2001:db8:1::/48"}
+	if result := a.Intersect(b).Strings(); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Intersect() = %v; ожидается %v", result, expected)
+	}
+}
+
+// Тест для Contains, ContainsPrefix, Overlaps и Count
+func TestQueries(t *testing.T) {
+	set := mustParse(t, "10.0.0.0/24", "10.0.2.0/24", "2001:db8::/127")
+
+	if !set.Contains(netip.MustParseAddr("10.0.2.7")) || set.Contains(netip.MustParseAddr("10.0.1.7")) {
+		t.Error("Contains() работает неверно")
+	}
+	if !set.ContainsPrefix(netip.MustParsePrefix("10.0.0.128/25")) || set.ContainsPrefix(netip.MustParsePrefix("10.0.0.0/22")) {
+		t.Error("ContainsPrefix() работает неверно")
+	}
+	if !set.Overlaps(netip.MustParsePrefix("10.0.0.0/22")) || set.Overlaps(netip.MustParsePrefix("10.0.1.0/24")) {
+		t.Error("Overlaps() работает неверно")
+	}
+	if count := set.Count().Int64(); count != 514 {
+		t.Errorf("Count() = %d; ожидается 514", count)
+	}
+
+	var empty *Set
+	if !empty.Union(nil).IsEmpty() || empty.Contains(netip.MustParseAddr("10.0.0.1")) {
+		t.Error("nil должен вести себя как пустое множество")
+	}
+}
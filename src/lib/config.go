@@ -1,33 +1,271 @@
 package lib
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 var ConfigFile = "config.json"
 
-type Config struct {
+// Profile - набор подсетей со своими источниками и исключениями, который
+// маршрутизируется через свой интерфейс или шлюз и хранится в своем файле
+type Profile struct {
+	Name           string   `json:"name"`
+	Priority       int      `json:"priority"`
 	CountryCode    string   `json:"country_code"`
+	CountryCodes   []string `json:"country_codes"`
+	Invert         bool     `json:"invert"`
 	FilePath       string   `json:"file_path"`
 	Interface      string   `json:"interface"`
+	InterfaceV6    string   `json:"interface_v6"`
+	Gateway        string   `json:"gateway"`
+	GatewayV6      string   `json:"gateway_v6"`
 	IgnoredSubnets []string `json:"ignored_subnets"`
 	IgnoredIPs     []string `json:"ignored_ips"`
+	// Подсети и файлы со списками подсетей, которые добавляются к данным источников
+	IncludedSubnets []string `json:"included_subnets"`
+	IncludedFiles   []string `json:"included_files"`
+	IPv6            bool     `json:"ipv6"`
+	Metric          int      `json:"metric"`
+	Table           string   `json:"table"`
+	Proto           string   `json:"proto"`
+	RouteType       string   `json:"route_type"`
+	Policy          *Policy  `json:"policy"`
+	SetName         string   `json:"set_name"`
+	NftTable        string   `json:"nft_table"`
+	RciURL          string   `json:"rci_url"`
+	Sources         []Source `json:"sources"`
+	// Combine - как объединяются наборы источников: union или intersect
+	Combine string `json:"combine"`
+}
+
+// Config - конфигурация. Поля профиля на верхнем уровне описывают
+// единственный профиль (прежний формат), profiles - несколько профилей.
+type Config struct {
+	Profile
+	Profiles    []Profile `json:"profiles"`
+	Backend     string    `json:"backend"`
+	CacheDir    string    `json:"cache_dir"`
+	CacheMaxAge string    `json:"cache_max_age"`
+	// Расписание режима демона
+	RefreshInterval string `json:"refresh_interval"`
+	RefreshJitter   string `json:"refresh_jitter"`
+	RetryMin        string `json:"retry_min"`
+	RetryMax        string `json:"retry_max"`
 }
 
-// Функция для загрузки конфигурационного файла
+// Функция для загрузки конфигурационного файла. Поверх основного файла
+// по порядку накладываются файлы config.d/*.json из того же каталога,
+// а затем переменные окружения ROUTING_RIPE_<КЛЮЧ>.
 func LoadConfig(filePath string) (*Config, error) {
-	data, err := ioutil.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения конфигурационного файла: %v", err)
+	var config Config
+	if err := config.mergeFile(filePath); err != nil {
+		return nil, err
 	}
 
-	var config Config
-	err = json.Unmarshal(data, &config)
+	dropIns, err := filepath.Glob(filepath.Join(filepath.Dir(filePath), ConfigDropInDir, "*.json"))
 	if err != nil {
-		return nil, fmt.Errorf("ошибка разбора конфигурационного файла: %v", err)
+		return nil, fmt.Errorf("ошибка поиска файлов %s: %v", ConfigDropInDir, err)
+	}
+	for _, dropIn := range dropIns {
+		if err = config.mergeFile(dropIn); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = config.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	if err = config.validateProfiles(); err != nil {
+		return nil, err
 	}
 
 	return &config, nil
 }
+
+// RoutingProfiles возвращает профили из profiles, а если их нет -
+// единственный профиль default из полей верхнего уровня
+func (c *Config) RoutingProfiles() []Profile {
+	if len(c.Profiles) == 0 {
+		profile := c.Profile
+		if profile.Name == "" {
+			profile.Name = "default"
+		}
+		return []Profile{profile}
+	}
+	return c.Profiles
+}
+
+// validateProfiles проверяет, что профили различимы и не делят файл подсетей
+func (c *Config) validateProfiles() error {
+	names := make(map[string]bool)
+	files := make(map[string]string)
+	for i, profile := range c.RoutingProfiles() {
+		if profile.Name == "" {
+			return fmt.Errorf("у профиля №%d не задано имя", i+1)
+		}
+		if names[profile.Name] {
+			return fmt.Errorf("профиль %s описан дважды", profile.Name)
+		}
+		names[profile.Name] = true
+
+		if profile.FilePath == "" {
+			return fmt.Errorf("профиль %s: не задан file_path", profile.Name)
+		}
+		if other, ok := files[profile.FilePath]; ok {
+			return fmt.Errorf("профили %s и %s используют один файл %s", other, profile.Name, profile.FilePath)
+		}
+		files[profile.FilePath] = profile.Name
+
+		options, err := profile.RouteOptions()
+		if err != nil {
+			return fmt.Errorf("профиль %s: %v", profile.Name, err)
+		}
+		if err = profile.checkBackend(c.Backend, options); err != nil {
+			return fmt.Errorf("профиль %s: %v", profile.Name, err)
+		}
+		if !SetBackend(c.Backend) && options.Type == "unicast" && profile.Interface == "" && profile.Gateway == "" {
+			return fmt.Errorf("профиль %s: не задан ни interface, ни gateway", profile.Name)
+		}
+		if _, err = profile.PolicyRules(); err != nil {
+			return fmt.Errorf("профиль %s: %v", profile.Name, err)
+		}
+		if profile.Combine != "" && profile.Combine != CombineUnion && profile.Combine != CombineIntersect {
+			return fmt.Errorf("профиль %s: неизвестный способ объединения combine %s", profile.Name, profile.Combine)
+		}
+		for _, source := range profile.Sources {
+			if err = source.validate(); err != nil {
+				return fmt.Errorf("профиль %s: %v", profile.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkBackend отклоняет параметры, которые бэкенд молча не применил бы.
+// Keenetic добавляет маршруты через RCI в основную таблицу без метрики,
+// протокола и типа, а бэкенды наборов вообще не заполняют таблицу, поэтому
+// правилам policy нечего в ней искать.
+func (p *Profile) checkBackend(kind string, options RouteOptions) error {
+	switch {
+	case kind == "keenetic":
+		var unsupported []string
+		if options.Metric != 0 {
+			unsupported = append(unsupported, "metric")
+		}
+		if options.table() != routeTables["main"] {
+			unsupported = append(unsupported, "table")
+		}
+		if options.protocol() != routeProtos["boot"] {
+			unsupported = append(unsupported, "proto")
+		}
+		if options.Type != "unicast" {
+			unsupported = append(unsupported, "route_type")
+		}
+		if p.Policy != nil {
+			unsupported = append(unsupported, "policy")
+		}
+		if len(unsupported) > 0 {
+			return fmt.Errorf("бэкенд keenetic не поддерживает %s", strings.Join(unsupported, ", "))
+		}
+	case SetBackend(kind) && p.Policy != nil:
+		return fmt.Errorf("бэкенд %s заполняет наборы, а не таблицу маршрутов, policy не поддерживается", kind)
+	}
+	return nil
+}
+
+// Countries возвращает коды стран из country_code и country_codes без повторов
+func (p *Profile) Countries() []string {
+	return normalizeCountries(append([]string{p.CountryCode}, p.CountryCodes...))
+}
+
+// RouteOptions возвращает параметры маршрутов профиля
+func (p *Profile) RouteOptions() (RouteOptions, error) {
+	options := RouteOptions{
+		Interface:   p.Interface,
+		InterfaceV6: p.InterfaceV6,
+		Gateway:     p.Gateway,
+		GatewayV6:   p.GatewayV6,
+		Metric:      p.Metric,
+		SetName:     p.SetName,
+		NftTable:    p.NftTable,
+		RciURL:      p.RciURL,
+		Comment:     "routing_ripe:" + p.Name,
+	}
+	if options.SetName == "" {
+		options.SetName = "ripe_" + p.Name
+	}
+	if options.NftTable == "" {
+		options.NftTable = DefaultNftTable
+	}
+
+	var err error
+	if options.Table, err = parseRouteTable(p.Table); err != nil {
+		return options, err
+	}
+	if options.Protocol, err = parseRouteProto(p.Proto); err != nil {
+		return options, err
+	}
+	if options.Type, err = parseRouteType(p.RouteType); err != nil {
+		return options, err
+	}
+	if options.Metric < 0 {
+		return options, fmt.Errorf("некорректная метрика %d", options.Metric)
+	}
+	return options, nil
+}
+
+// Cache возвращает кэш ответов RIPEstat. По умолчанию кэш лежит в каталоге
+// cache рядом с файлом подсетей и используется не дольше DefaultCacheMaxAge.
+func (c *Config) Cache() (*Cache, error) {
+	cache := &Cache{Dir: c.CacheDir, MaxAge: DefaultCacheMaxAge}
+	if cache.Dir == "" {
+		cache.Dir = filepath.Join(filepath.Dir(c.RoutingProfiles()[0].FilePath), "cache")
+	}
+	if c.CacheMaxAge != "" {
+		maxAge, err := time.ParseDuration(c.CacheMaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка разбора cache_max_age: %v", err)
+		}
+		cache.MaxAge = maxAge
+	}
+	return cache, nil
+}
+
+// Schedule возвращает расписание обновлений режима демона.
+// Незаданные значения берутся по умолчанию.
+func (c *Config) Schedule() (*Schedule, error) {
+	schedule := &Schedule{
+		Interval: DefaultRefreshInterval,
+		Jitter:   DefaultRefreshJitter,
+		RetryMin: DefaultRetryMin,
+		RetryMax: DefaultRetryMax,
+	}
+	for _, field := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"refresh_interval", c.RefreshInterval, &schedule.Interval},
+		{"refresh_jitter", c.RefreshJitter, &schedule.Jitter},
+		{"retry_min", c.RetryMin, &schedule.RetryMin},
+		{"retry_max", c.RetryMax, &schedule.RetryMax},
+	} {
+		if field.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(field.value)
+		if err != nil || duration < 0 {
+			return nil, fmt.Errorf("ошибка разбора %s: %s", field.name, field.value)
+		}
+		*field.dest = duration
+	}
+	if schedule.Interval <= 0 || schedule.RetryMin <= 0 || schedule.RetryMax < schedule.RetryMin {
+		return nil, fmt.Errorf("некорректное расписание обновлений")
+	}
+	return schedule, nil
+}
@@ -0,0 +1,140 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+const (
+	// ConfigDropInDir - каталог рядом с конфигурацией, файлы которого
+	// накладываются на нее в порядке имен
+	ConfigDropInDir = "config.d"
+	// ConfigEnvPrefix - префикс переменных окружения, переопределяющих ключи конфигурации
+	ConfigEnvPrefix = "ROUTING_RIPE_"
+)
+
+// ConfigSearchPath - где искать конфигурацию, если путь не указан явно
+var ConfigSearchPath = []string{"/opt/routing/config.json", "/etc/routing_ripe/config.json"}
+
+// FindConfig возвращает путь к конфигурации: явно указанный, из переменной
+// ROUTING_RIPE_CONFIG или первый существующий из ConfigSearchPath. При
+// отладке (переменная DEBUG) сначала проверяется config.json в текущем каталоге.
+func FindConfig(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	if path = os.Getenv(ConfigEnvPrefix + "CONFIG"); path != "" {
+		return path, nil
+	}
+
+	candidates := ConfigSearchPath
+	if os.Getenv("DEBUG") != "" {
+		candidates = append([]string{ConfigFile}, candidates...)
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("конфигурация не найдена, проверены пути: %s", strings.Join(candidates, ", "))
+}
+
+// mergeFile накладывает файл на конфигурацию: ключи, которых нет в
+// файле, сохраняют прежние значения
+func (c *Config) mergeFile(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения конфигурационного файла: %v", err)
+	}
+
+	var keys map[string]json.RawMessage
+	if err = json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("ошибка разбора конфигурационного файла %s: %v", filePath, err)
+	}
+	// json заполняет элементы имеющегося среза поверх старых значений,
+	// поэтому списки из файла (profiles, sources, ignored_ips и другие)
+	// заменяют прежние целиком
+	present := make(map[string]bool, len(keys))
+	for key := range keys {
+		present[strings.ToLower(key)] = true
+	}
+	resetFields(reflect.ValueOf(c).Elem(), present)
+
+	if err = json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("ошибка разбора конфигурационного файла %s: %v", filePath, err)
+	}
+	return nil
+}
+
+// resetFields обнуляет срезы, словари и указатели, ключи которых есть в present
+func resetFields(v reflect.Value, present map[string]bool) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Anonymous {
+			resetFields(v.Field(i), present)
+			continue
+		}
+		key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !present[key] {
+			continue
+		}
+		switch v.Field(i).Kind() {
+		case reflect.Slice, reflect.Map, reflect.Pointer:
+			v.Field(i).SetZero()
+		}
+	}
+}
+
+// applyEnv переопределяет ключи конфигурации переменными окружения
+// ROUTING_RIPE_<КЛЮЧ В ВЕРХНЕМ РЕГИСТРЕ>, например ROUTING_RIPE_INTERFACE=wg0.
+// Строки берутся как есть, списки строк - через запятую, остальные
+// значения (числа, true/false, profiles, policy) - в виде JSON.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	return applyEnvFields(reflect.ValueOf(c).Elem(), lookup)
+}
+
+func applyEnvFields(v reflect.Value, lookup func(string) (string, bool)) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Anonymous {
+			if err := applyEnvFields(v.Field(i), lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		name := ConfigEnvPrefix + strings.ToUpper(key)
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+
+		target := v.Field(i)
+		switch {
+		case target.Kind() == reflect.String:
+			target.SetString(value)
+		case target.Type() == reflect.TypeOf([]string{}) && !strings.HasPrefix(strings.TrimSpace(value), "["):
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			target.Set(reflect.ValueOf(items))
+		default:
+			fresh := reflect.New(target.Type())
+			if err := json.Unmarshal([]byte(value), fresh.Interface()); err != nil {
+				return fmt.Errorf("ошибка разбора переменной %s: %v", name, err)
+			}
+			target.Set(fresh.Elem())
+		}
+	}
+	return nil
+}
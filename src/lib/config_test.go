@@ -0,0 +1,245 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Тест для LoadConfig в прежнем формате с одним профилем
+func TestLoadConfigLegacy(t *testing.T) {
+	path := writeConfig(t, `{"country_code": "ru", "file_path": "/opt/routing/subnets.txt", "interface": "ppp0"}`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Ошибка LoadConfig: %v", err)
+	}
+	profiles := config.RoutingProfiles()
+	if len(profiles) != 1 || profiles[0].Name != "default" || profiles[0].Interface != "ppp0" {
+		t.Errorf("RoutingProfiles() = %+v; ожидается один профиль default", profiles)
+	}
+	if countries := profiles[0].Countries(); len(countries) != 1 || countries[0] != "RU" {
+		t.Errorf("Countries() = %v; ожидается [RU]", countries)
+	}
+}
+
+// Тест для LoadConfig с несколькими профилями
+func TestLoadConfigProfiles(t *testing.T) {
+	path := writeConfig(t, `{
+		"profiles": [
+			{"name": "ru", "country_codes": ["RU", "BY"], "file_path": "/tmp/ru.txt", "interface": "ppp0"},
+			{"name": "vpn", "country_code": "US", "file_path": "/tmp/vpn.txt", "gateway": "10.8.0.1", "priority": 10}
+		]
+	}`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Ошибка LoadConfig: %v", err)
+	}
+	profiles := config.RoutingProfiles()
+	if len(profiles) != 2 || profiles[1].Name != "vpn" || profiles[1].Priority != 10 {
+		t.Errorf("RoutingProfiles() = %+v", profiles)
+	}
+}
+
+// Тест для LoadConfig с некорректными профилями
+func TestLoadConfigInvalidProfiles(t *testing.T) {
+	tests := []string{
+		`{"profiles": [{"name": "a", "file_path": "/tmp/a.txt", "interface": "ppp0"}, {"name": "a", "file_path": "/tmp/b.txt", "interface": "ppp0"}]}`,
+		`{"profiles": [{"name": "a", "file_path": "/tmp/a.txt", "interface": "ppp0"}, {"name": "b", "file_path": "/tmp/a.txt", "interface": "wg0"}]}`,
+		`{"profiles": [{"name": "a", "file_path": "/tmp/a.txt"}]}`,
+		`{"profiles": [{"file_path": "/tmp/a.txt", "interface": "ppp0"}]}`,
+		`{"file_path": "/tmp/a.txt", "interface": "ppp0", "sources": [{"type": "whois"}]}`,
+		`{"file_path": "/tmp/a.txt", "interface": "ppp0", "sources": [{"type": "delegated", "registry": "iana"}]}`,
+		`{"file_path": "/tmp/a.txt", "interface": "ppp0", "sources": [{"type": "asn", "asns": ["AS15169", "google"]}]}`,
+		`{"file_path": "/tmp/a.txt", "interface": "ppp0", "sources": [{"type": "dns", "domains": ["gosuslugi.ru"], "prefix_v4": 33}]}`,
+		`{"file_path": "/tmp/a.txt", "interface": "ppp0", "sources": [{"type": "mmdb"}]}`,
+		`{"file_path": "/tmp/a.txt", "interface": "ppp0", "combine": "xor"}`,
+		`{"backend": "keenetic", "file_path": "/tmp/a.txt", "interface": "ppp0", "metric": 10}`,
+		`{"backend": "keenetic", "file_path": "/tmp/a.txt", "interface": "ppp0", "table": "100"}`,
+		`{"backend": "keenetic", "file_path": "/tmp/a.txt", "interface": "ppp0", "proto": "static"}`,
+		`{"backend": "keenetic", "file_path": "/tmp/a.txt", "route_type": "blackhole"}`,
+		`{"backend": "keenetic", "file_path": "/tmp/a.txt", "interface": "ppp0", "policy": {"fwmark": "0x1"}}`,
+		`{"backend": "ipset", "file_path": "/tmp/a.txt", "table": "100", "policy": {"fwmark": "0x1"}}`,
+		`{"backend": "nftables", "file_path": "/tmp/a.txt", "table": "100", "policy": {"fwmark": "0x1"}}`,
+	}
+
+	for _, test := range tests {
+		if _, err := LoadConfig(writeConfig(t, test)); err == nil {
+			t.Errorf("LoadConfig(%s) должна вернуть ошибку", test)
+		}
+	}
+}
+
+// Тест для LoadConfig с бэкендом наборов: интерфейс и шлюз не нужны
+func TestLoadConfigSetBackend(t *testing.T) {
+	path := writeConfig(t, `{"backend": "ipset", "profiles": [{"name": "ru", "country_code": "RU", "file_path": "/tmp/ru.txt"}]}`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Ошибка LoadConfig: %v", err)
+	}
+	options, _ := config.RoutingProfiles()[0].RouteOptions()
+	if options.SetName != "ripe_ru" || options.NftTable != DefaultNftTable {
+		t.Errorf("RouteOptions() = %+v", options)
+	}
+}
+
+// Тест для LoadConfig с файлами config.d: ключи накладываются по порядку имен
+func TestLoadConfigDropIns(t *testing.T) {
+	path := writeConfig(t, `{"country_code": "RU", "file_path": "/tmp/ru.txt", "interface": "ppp0", "ignored_ips": ["1.1.1.1"]}`)
+	dropIns := filepath.Join(filepath.Dir(path), ConfigDropInDir)
+	if err := os.Mkdir(dropIns, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"10-vpn.json":   `{"interface": "wg0", "backend": "ip"}`,
+		"20-local.json": `{"interface": "wg1"}`,
+		"readme.txt":    `не конфигурация`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dropIns, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Ошибка LoadConfig: %v", err)
+	}
+	if config.Interface != "wg1" || config.Backend != "ip" || config.CountryCode != "RU" || len(config.IgnoredIPs) != 1 {
+		t.Errorf("LoadConfig() = %+v", config)
+	}
+}
+
+// Тест для LoadConfig: список профилей из config.d заменяет прежний целиком
+func TestLoadConfigDropInProfiles(t *testing.T) {
+	path := writeConfig(t, `{"profiles": [{"name": "ru", "file_path": "/tmp/ru.txt", "interface": "ppp0", "invert": true}]}`)
+	dropIns := filepath.Join(filepath.Dir(path), ConfigDropInDir)
+	if err := os.Mkdir(dropIns, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := os.WriteFile(filepath.Join(dropIns, "profiles.json"),
+		[]byte(`{"profiles": [{"name": "by", "file_path": "/tmp/by.txt", "interface": "wg0"}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Ошибка LoadConfig: %v", err)
+	}
+	if len(config.Profiles) != 1 || config.Profiles[0].Name != "by" || config.Profiles[0].Invert {
+		t.Errorf("Profiles = %+v", config.Profiles)
+	}
+}
+
+// Тест для LoadConfig: списки из config.d заменяют прежние целиком, без
+// остатков полей прежних элементов
+func TestLoadConfigDropInSources(t *testing.T) {
+	path := writeConfig(t, `{"country_code": "RU", "file_path": "/tmp/ru.txt", "interface": "ppp0", "table": "100",
+		"ignored_ips": ["1.1.1.1", "8.8.8.8"], "policy": {"priority": 100, "fwmark": "0x1"},
+		"sources": [{"type": "mmdb", "url": "https://example.test/country.mmdb"}, {"type": "ripestat", "fallback": true}]}`)
+	dropIns := filepath.Join(filepath.Dir(path), ConfigDropInDir)
+	if err := os.Mkdir(dropIns, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := os.WriteFile(filepath.Join(dropIns, "local.json"),
+		[]byte(`{"ignored_ips": ["9.9.9.9"], "policy": {"priority": 200}, "sources": [{"type": "mmdb", "path": "/opt/routing/country.mmdb"}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Ошибка LoadConfig: %v", err)
+	}
+	expected := []Source{{Type: "mmdb", Path: "/opt/routing/country.mmdb"}}
+	if !reflect.DeepEqual(config.Sources, expected) {
+		t.Errorf("Sources = %+v; ожидается %+v", config.Sources, expected)
+	}
+	if !reflect.DeepEqual(config.IgnoredIPs, []string{"9.9.9.9"}) {
+		t.Errorf("IgnoredIPs = %v; ожидается [9.9.9.9]", config.IgnoredIPs)
+	}
+	if config.Policy == nil || config.Policy.Priority != 200 || config.Policy.FwMark != "" {
+		t.Errorf("Policy = %+v; ожидается только priority 200", config.Policy)
+	}
+}
+
+// Тест для Config.applyEnv: переменные окружения переопределяют ключи
+func TestConfigApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"ROUTING_RIPE_INTERFACE":      "wg0",
+		"ROUTING_RIPE_IPV6":           "true",
+		"ROUTING_RIPE_METRIC":         "50",
+		"ROUTING_RIPE_COUNTRY_CODES":  "BY, KZ",
+		"ROUTING_RIPE_IGNORED_IPS":    `["1.1.1.1"]`,
+		"ROUTING_RIPE_POLICY":         `{"priority": 100}`,
+		"ROUTING_RIPE_CACHE_MAX_AGE":  "24h",
+		"ROUTING_RIPE_UNKNOWN_OPTION": "x",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	config := &Config{Profile: Profile{Interface: "ppp0", Metric: 10}}
+	if err := config.applyEnv(lookup); err != nil {
+		t.Fatalf("Ошибка applyEnv: %v", err)
+	}
+	if config.Interface != "wg0" || !config.IPv6 || config.Metric != 50 || config.CacheMaxAge != "24h" {
+		t.Errorf("applyEnv() = %+v", config)
+	}
+	if !reflect.DeepEqual(config.CountryCodes, []string{"BY", "KZ"}) || !reflect.DeepEqual(config.IgnoredIPs, []string{"1.1.1.1"}) {
+		t.Errorf("списки = %v, %v", config.CountryCodes, config.IgnoredIPs)
+	}
+	if config.Policy == nil || config.Policy.Priority != 100 {
+		t.Errorf("Policy = %+v", config.Policy)
+	}
+
+	env = map[string]string{"ROUTING_RIPE_METRIC": "много"}
+	if err := config.applyEnv(lookup); err == nil {
+		t.Error("applyEnv() должна вернуть ошибку для некорректного числа")
+	}
+}
+
+// Тест для FindConfig: явный путь, переменная окружения и путь поиска
+func TestFindConfig(t *testing.T) {
+	t.Setenv("DEBUG", "")
+	t.Setenv("ROUTING_RIPE_CONFIG", "")
+	found := writeConfig(t, `{}`)
+	searchPath := ConfigSearchPath
+	defer func() { ConfigSearchPath = searchPath }()
+	ConfigSearchPath = []string{filepath.Join(t.TempDir(), "missing.json"), found}
+
+	tests := []struct {
+		explicit string
+		env      string
+		expected string
+	}{
+		{"/etc/custom.json", "/etc/env.json", "/etc/custom.json"},
+		{"", "/etc/env.json", "/etc/env.json"},
+		{"", "", found},
+	}
+	for _, test := range tests {
+		t.Setenv("ROUTING_RIPE_CONFIG", test.env)
+		if result, err := FindConfig(test.explicit); err != nil || result != test.expected {
+			t.Errorf("FindConfig(%q) = %s, %v; ожидается %s", test.explicit, result, err, test.expected)
+		}
+	}
+
+	ConfigSearchPath = ConfigSearchPath[:1]
+	if _, err := FindConfig(""); err == nil {
+		t.Error("FindConfig() должна вернуть ошибку, если конфигурации нет")
+	}
+}
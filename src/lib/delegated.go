@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DelegatedURLs - файлы delegated-extended региональных регистраторов
+var DelegatedURLs = map[string]string{
+	"ripencc": "https://ftp.ripe.net/pub/stats/ripencc/delegated-ripencc-extended-latest",
+	"arin":    "https://ftp.arin.net/pub/stats/arin/delegated-arin-extended-latest",
+	"apnic":   "https://ftp.apnic.net/stats/apnic/delegated-apnic-extended-latest",
+	"lacnic":  "https://ftp.lacnic.net/pub/stats/lacnic/delegated-lacnic-extended-latest",
+	"afrinic": "https://ftp.afrinic.net/pub/stats/afrinic/delegated-afrinic-extended-latest",
+}
+
+// DefaultDelegatedStatuses - статусы записей, которые означают, что адреса выданы
+var DefaultDelegatedStatuses = []string{"allocated", "assigned"}
+
+// CountryResources - ресурсы страны: подсети и диапазоны адресов в формате RIPEstat
+type CountryResources struct {
+	IPv4 []string
+	IPv6 []string
+}
+
+// ParseDelegated разбирает файл delegated-extended и возвращает ресурсы
+// стран countries с одним из статусов statuses. Записи IPv4 задаются
+// начальным адресом и числом адресов и возвращаются диапазонами, записи
+// IPv6 - подсетями. Строка версии, сводные строки и комментарии пропускаются.
+func ParseDelegated(data []byte, countries, statuses []string) (map[string]CountryResources, error) {
+	result := make(map[string]CountryResources)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "|")
+		// Строка версии: 2|ripencc|20240101|...; сводная строка: ripencc|*|ipv4|*|count|summary
+		if isDelegatedVersion(fields[0]) || (len(fields) > 1 && fields[1] == "*") {
+			continue
+		}
+		if len(fields) < 7 {
+			return nil, fmt.Errorf("строка %d: некорректная запись %q", line, text)
+		}
+
+		country := strings.ToUpper(fields[1])
+		kind := fields[2]
+		if kind != "ipv4" && kind != "ipv6" {
+			continue
+		}
+		if !slices.Contains(countries, country) || !slices.Contains(statuses, strings.ToLower(fields[6])) {
+			continue
+		}
+
+		resource, err := delegatedResource(kind, fields[3], fields[4])
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: %v", line, err)
+		}
+		resources := result[country]
+		if kind == "ipv4" {
+			resources.IPv4 = append(resources.IPv4, resource)
+		} else {
+			resources.IPv6 = append(resources.IPv6, resource)
+		}
+		result[country] = resources
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла delegated: %v", err)
+	}
+	return result, nil
+}
+
+// delegatedResource преобразует запись IPv4 (адрес и число адресов) в
+// диапазон, а запись IPv6 (адрес и длина префикса) - в подсеть
+func delegatedResource(kind, start, value string) (string, error) {
+	addr, err := netip.ParseAddr(start)
+	if err != nil || addr.Is4() != (kind == "ipv4") {
+		return "", fmt.Errorf("некорректный адрес %s", start)
+	}
+
+	if kind == "ipv6" {
+		bits, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("некорректная длина префикса %s", value)
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil || prefix.Addr() != addr {
+			return "", fmt.Errorf("некорректная подсеть %s/%s", start, value)
+		}
+		return prefix.String(), nil
+	}
+
+	count, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || count == 0 {
+		return "", fmt.Errorf("некорректное число адресов %s", value)
+	}
+	first := addr.As4()
+	last := uint64(binary.BigEndian.Uint32(first[:])) + count - 1
+	if last > 0xffffffff {
+		return "", fmt.Errorf("диапазон %s + %d выходит за пределы IPv4", start, count)
+	}
+	var end [4]byte
+	binary.BigEndian.PutUint32(end[:], uint32(last))
+	return start + "-" + netip.AddrFrom4(end).String(), nil
+}
+
+// isDelegatedVersion сообщает, что первое поле - номер версии формата
+func isDelegatedVersion(field string) bool {
+	_, err := strconv.ParseFloat(field, 64)
+	return err == nil
+}
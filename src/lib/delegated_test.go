@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+const delegatedFixture = `# комментарий
+2|ripencc|1700000000|5|19830705|20240101|+0100
+ripencc|*|asn|*|2|summary
+ripencc|*|ipv4|*|4|summary
+ripencc|*|ipv6|*|2|summary
+ripencc|RU|asn|8359|1|19970805|allocated|a1
+ripencc|RU|ipv4|2.56.0.0|1024|20190101|allocated|a1
+ripencc|ru|ipv4|5.8.0.0|768|20120101|assigned|a2
+ripencc|BY|ipv4|31.40.0.0|1024|20120101|allocated|a3
+ripencc|RU|ipv4|45.0.0.0|256|20200101|reserved|a4
+ripencc|RU|ipv6|2a00:1fa0::|29|20120101|allocated|a1
+ripencc||ipv4|185.0.0.0|256||available|
+`
+
+// Тест для ParseDelegated: фильтр по стране и статусу, IPv4 записи
+// превращаются в диапазоны, IPv6 - в подсети
+func TestParseDelegated(t *testing.T) {
+	tests := []struct {
+		countries []string
+		statuses  []string
+		expected  map[string]CountryResources
+	}{
+		{
+			[]string{"RU"}, DefaultDelegatedStatuses,
+			map[string]CountryResources{"RU": {
+				IPv4: []string{"2.56.0.0-2.56.3.255", "5.8.0.0-5.8.2.255"},
+				IPv6: []string{"2a00:1fa0::/29"},
+			}},
+		},
+		{
+			[]string{"RU", "BY"}, []string{"reserved"},
+			map[string]CountryResources{"RU": {IPv4: []string{"45.0.0.0-45.0.0.255"}}},
+		},
+		{
+			[]string{"KZ"}, DefaultDelegatedStatuses,
+			map[string]CountryResources{},
+		},
+	}
+
+	for _, test := range tests {
+		result, err := ParseDelegated([]byte(delegatedFixture), test.countries, test.statuses)
+		if err != nil {
+			t.Fatalf("Ошибка ParseDelegated(%v): %v", test.countries, err)
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("ParseDelegated(%v, %v) = %v; ожидается %v", test.countries, test.statuses, result, test.expected)
+		}
+	}
+}
+
+// Тест для ParseDelegated: некорректные записи выбранных стран - ошибка
+func TestParseDelegatedInvalid(t *testing.T) {
+	tests := []string{
+		"ripencc|RU|ipv4|2.56.0.0",
+		"ripencc|RU|ipv4|2.56.0.0|0|20190101|allocated",
+		"ripencc|RU|ipv4|255.255.255.0|512|20190101|allocated",
+		"ripencc|RU|ipv4|2a00::|256|20190101|allocated",
+		"ripencc|RU|ipv6|2a00:1fa0::1|29|20120101|allocated",
+	}
+
+	for _, line := range tests {
+		if _, err := ParseDelegated([]byte(line), []string{"RU"}, DefaultDelegatedStatuses); err == nil {
+			t.Errorf("ParseDelegated(%q) должна вернуть ошибку", line)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Типы записей DNS
+const (
+	DNSTypeA    = 1
+	DNSTypeAAAA = 28
+)
+
+const (
+	dnsClassIN = 1
+	// dnsNegativeTTL - сколько хранится ответ без адресов
+	dnsNegativeTTL = 5 * time.Minute
+	dnsTimeout     = 5 * time.Second
+)
+
+// DNSEntry - адреса одного имени и типа записи с учетом TTL
+type DNSEntry struct {
+	Name  string
+	Type  uint16
+	Addrs []netip.Addr
+	// Refreshed - когда выполнен запрос, Expires - до какого времени ответ действителен
+	Refreshed time.Time
+	Expires   time.Time
+	// Stale - запрос не удался и возвращен прежний ответ
+	Stale bool
+}
+
+// Resolver запрашивает записи A и AAAA у сервера DNS и хранит каждый ответ
+// до истечения его TTL, чтобы не повторять запросы при частых обновлениях
+type Resolver struct {
+	// Server - адрес сервера DNS в виде host:port
+	Server  string
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*DNSEntry
+}
+
+// NewResolver создает Resolver для сервера server. Пустой адрес означает
+// первый nameserver из /etc/resolv.conf, порт по умолчанию - 53.
+func NewResolver(server string) *Resolver {
+	if server == "" {
+		server = systemNameserver("/etc/resolv.conf")
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+	}
+	return &Resolver{Server: server, Timeout: dnsTimeout, entries: make(map[string]*DNSEntry)}
+}
+
+// Resolve возвращает адреса имени name для записи qtype. Пока не истек TTL
+// прежнего ответа, запрос не выполняется. Если запрос не удался, а прежний
+// ответ есть, он возвращается с признаком Stale.
+func (r *Resolver) Resolve(name string, qtype uint16) (*DNSEntry, error) {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	key := fmt.Sprintf("%s/%d", name, qtype)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if entry, ok := r.entries[key]; ok && now.Before(entry.Expires) {
+		return entry, nil
+	}
+
+	addrs, ttl, err := r.query(name, qtype)
+	if err != nil {
+		if entry, ok := r.entries[key]; ok {
+			stale := *entry
+			stale.Stale = true
+			return &stale, nil
+		}
+		return nil, err
+	}
+	entry := &DNSEntry{Name: name, Type: qtype, Addrs: addrs, Refreshed: now, Expires: now.Add(ttl)}
+	r.entries[key] = entry
+	return entry, nil
+}
+
+// query выполняет запрос по UDP, а если ответ обрезан - повторяет его по TCP
+func (r *Resolver) query(name string, qtype uint16) ([]netip.Addr, time.Duration, error) {
+	id := uint16(rand.N(1 << 16))
+	query, err := encodeDNSQuery(id, name, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	response, err := r.exchange("udp", query)
+	if err != nil {
+		return nil, 0, err
+	}
+	addrs, ttl, err := parseDNSResponse(response, id, qtype)
+	if err == errDNSTruncated {
+		if response, err = r.exchange("tcp", query); err != nil {
+			return nil, 0, err
+		}
+		addrs, ttl, err = parseDNSResponse(response, id, qtype)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", name, err)
+	}
+	return addrs, ttl, nil
+}
+
+// exchange отправляет запрос серверу и читает ответ. По TCP сообщения
+// предваряются двухбайтовой длиной.
+func (r *Resolver) exchange(network string, query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout(network, r.Server, r.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к DNS %s: %v", r.Server, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(r.Timeout))
+
+	if network == "udp" {
+		if _, err = conn.Write(query); err != nil {
+			return nil, fmt.Errorf("ошибка запроса к DNS %s: %v", r.Server, err)
+		}
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения ответа DNS %s: %v", r.Server, err)
+		}
+		return buf[:n], nil
+	}
+
+	message := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err = conn.Write(append(message, query...)); err != nil {
+		return nil, fmt.Errorf("ошибка запроса к DNS %s: %v", r.Server, err)
+	}
+	reader := bufio.NewReader(conn)
+	var length uint16
+	if err = binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return nil, fmt.Errorf("ошибка чтения ответа DNS %s: %v", r.Server, err)
+	}
+	response := make([]byte, length)
+	if _, err = io.ReadFull(reader, response); err != nil {
+		return nil, fmt.Errorf("ошибка чтения ответа DNS %s: %v", r.Server, err)
+	}
+	return response, nil
+}
+
+// errDNSTruncated - ответ UDP обрезан и запрос нужно повторить по TCP
+var errDNSTruncated = errors.New("ответ DNS обрезан")
+
+// encodeDNSQuery кодирует запрос одной записи с рекурсией
+func encodeDNSQuery(id uint16, name string, qtype uint16) ([]byte, error) {
+	msg := binary.BigEndian.AppendUint16(nil, id)
+	// Флаги: RD; один вопрос, остальные секции пусты
+	msg = append(msg, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0)
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("некорректное имя %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	if len(msg) > 12+255 {
+		return nil, fmt.Errorf("слишком длинное имя %q", name)
+	}
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+	return msg, nil
+}
+
+// parseDNSResponse возвращает адреса записей qtype из секции ответов и
+// наименьший TTL среди них. Записи CNAME пропускаются: рекурсивный сервер
+// возвращает вместе с ними и адреса конечного имени.
+func parseDNSResponse(msg []byte, id, qtype uint16) ([]netip.Addr, time.Duration, error) {
+	if len(msg) < 12 {
+		return nil, 0, fmt.Errorf("короткий ответ DNS")
+	}
+	flags := binary.BigEndian.Uint16(msg[2:4])
+	switch {
+	case binary.BigEndian.Uint16(msg[0:2]) != id || flags&0x8000 == 0:
+		return nil, 0, fmt.Errorf("ответ DNS не соответствует запросу")
+	case flags&0x0200 != 0:
+		return nil, 0, errDNSTruncated
+	case flags&0x000f == 3:
+		return nil, 0, fmt.Errorf("имя не существует (NXDOMAIN)")
+	case flags&0x000f != 0:
+		return nil, 0, fmt.Errorf("сервер DNS вернул код ошибки %d", flags&0x000f)
+	}
+	questions := binary.BigEndian.Uint16(msg[4:6])
+	answers := binary.BigEndian.Uint16(msg[6:8])
+
+	offset := 12
+	var err error
+	for range questions {
+		if offset, err = skipDNSName(msg, offset); err != nil {
+			return nil, 0, err
+		}
+		offset += 4
+	}
+
+	var addrs []netip.Addr
+	ttl := time.Duration(-1)
+	for range answers {
+		if offset, err = skipDNSName(msg, offset); err != nil {
+			return nil, 0, err
+		}
+		if offset+10 > len(msg) {
+			return nil, 0, fmt.Errorf("короткий ответ DNS")
+		}
+		rtype := binary.BigEndian.Uint16(msg[offset:])
+		rttl := time.Duration(binary.BigEndian.Uint32(msg[offset+4:])) * time.Second
+		length := int(binary.BigEndian.Uint16(msg[offset+8:]))
+		offset += 10
+		if offset+length > len(msg) {
+			return nil, 0, fmt.Errorf("короткий ответ DNS")
+		}
+		data := msg[offset : offset+length]
+		offset += length
+
+		if rtype != qtype {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(data)
+		if !ok || (qtype == DNSTypeA) != addr.Is4() {
+			return nil, 0, fmt.Errorf("некорректный адрес в ответе DNS")
+		}
+		addrs = append(addrs, addr)
+		if ttl < 0 || rttl < ttl {
+			ttl = rttl
+		}
+	}
+	if len(addrs) == 0 {
+		ttl = dnsNegativeTTL
+	}
+	return addrs, ttl, nil
+}
+
+// skipDNSName возвращает смещение после имени, записанного метками или
+// ссылкой на ранее записанное имя
+func skipDNSName(msg []byte, offset int) (int, error) {
+	for offset < len(msg) {
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			return offset + 1, nil
+		case length&0xc0 == 0xc0:
+			return offset + 2, nil
+		}
+		offset += 1 + length
+	}
+	return 0, fmt.Errorf("короткий ответ DNS")
+}
+
+// systemNameserver возвращает первый nameserver из resolv.conf или 127.0.0.1
+func systemNameserver(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1]
+		}
+	}
+	return "127.0.0.1"
+}
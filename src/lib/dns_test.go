@@ -0,0 +1,230 @@
+package lib
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testDNSServer - локальный сервер DNS для тестов. Отвечает на запросы A и
+// AAAA адресами из records с записью CNAME перед ними; для имен из truncated
+// ответ по UDP обрезается, и адреса можно получить только по TCP.
+type testDNSServer struct {
+	records   map[string][]string
+	truncated map[string]bool
+	ttl       uint32
+	queries   atomic.Int32
+}
+
+// start запускает сервер на UDP и TCP на одном порту и возвращает его адрес
+func (s *testDNSServer) start(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", listener.Addr().String())
+	if err != nil {
+		listener.Close()
+		t.Skipf("не удалось занять порт UDP: %v", err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+		conn.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(s.answer(buf[:n], true), addr)
+		}
+	}()
+	go func() {
+		for {
+			client, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			var length uint16
+			if binary.Read(client, binary.BigEndian, &length) == nil {
+				query := make([]byte, length)
+				if _, err = io.ReadFull(client, query); err == nil {
+					response := s.answer(query, false)
+					client.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(response))), response...))
+				}
+			}
+			client.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// answer строит ответ на запрос с одним вопросом
+func (s *testDNSServer) answer(query []byte, udp bool) []byte {
+	s.queries.Add(1)
+	end, _ := skipDNSName(query, 12)
+	question := query[12 : end+4]
+	qtype := binary.BigEndian.Uint16(query[end:])
+
+	var labels []string
+	for offset := 12; query[offset] != 0; offset += 1 + int(query[offset]) {
+		labels = append(labels, string(query[offset+1:offset+1+int(query[offset])]))
+	}
+	name := strings.Join(labels, ".")
+
+	addrs, ok := s.records[name]
+	flags := uint16(0x8180)
+	if !ok {
+		flags |= 3
+	}
+	if udp && s.truncated[name] {
+		flags |= 0x0200
+		addrs = nil
+	}
+
+	var answers [][]byte
+	if len(addrs) > 0 {
+		// CNAME на то же имя: проверяет, что чужие записи пропускаются
+		record := []byte{0xc0, 12}
+		record = binary.BigEndian.AppendUint16(record, 5)
+		record = binary.BigEndian.AppendUint16(record, dnsClassIN)
+		record = binary.BigEndian.AppendUint32(record, s.ttl)
+		record = binary.BigEndian.AppendUint16(record, 2)
+		answers = append(answers, append(record, 0xc0, 12))
+	}
+	for _, value := range addrs {
+		addr := netip.MustParseAddr(value)
+		if (qtype == DNSTypeA) != addr.Is4() {
+			continue
+		}
+		record := []byte{0xc0, 12}
+		record = binary.BigEndian.AppendUint16(record, qtype)
+		record = binary.BigEndian.AppendUint16(record, dnsClassIN)
+		record = binary.BigEndian.AppendUint32(record, s.ttl)
+		record = binary.BigEndian.AppendUint16(record, uint16(addr.BitLen()/8))
+		answers = append(answers, append(record, addr.AsSlice()...))
+	}
+
+	msg := append([]byte{}, query[:2]...)
+	msg = binary.BigEndian.AppendUint16(msg, flags)
+	msg = append(msg, 0, 1)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(answers)))
+	msg = append(msg, 0, 0, 0, 0)
+	msg = append(msg, question...)
+	for _, record := range answers {
+		msg = append(msg, record...)
+	}
+	return msg
+}
+
+// Тест для Resolver: адреса A и AAAA, CNAME, NXDOMAIN и повтор по TCP
+func TestResolverResolve(t *testing.T) {
+	server := &testDNSServer{
+		records: map[string][]string{
+			"gosuslugi.test": {"213.59.254.7", "109.207.1.118", "2a0c:a9c7:8::1"},
+			"big.test":       {"10.0.0.1"},
+			"v6only.test":    {"2001:db8::1"},
+		},
+		truncated: map[string]bool{"big.test": true},
+		ttl:       300,
+	}
+	resolver := NewResolver(server.start(t))
+
+	tests := []struct {
+		name     string
+		qtype    uint16
+		expected []string
+		valid    bool
+	}{
+		{"gosuslugi.test", DNSTypeA, []string{"213.59.254.7", "109.207.1.118"}, true},
+		{"GosUslugi.test.", DNSTypeAAAA, []string{"2a0c:a9c7:8::1"}, true},
+		{"big.test", DNSTypeA, []string{"10.0.0.1"}, true},
+		{"v6only.test", DNSTypeA, nil, true},
+		{"missing.test", DNSTypeA, nil, false},
+	}
+
+	for _, test := range tests {
+		entry, err := resolver.Resolve(test.name, test.qtype)
+		if (err == nil) != test.valid {
+			t.Errorf("Resolve(%s, %d) = %v; ожидается корректность %v", test.name, test.qtype, err, test.valid)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var result []string
+		for _, addr := range entry.Addrs {
+			result = append(result, addr.String())
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Resolve(%s, %d) = %v; ожидается %v", test.name, test.qtype, result, test.expected)
+		}
+	}
+}
+
+// Тест для Resolver: ответ хранится до истечения TTL, а при недоступном
+// сервере возвращается прежний ответ с признаком Stale
+func TestResolverTTL(t *testing.T) {
+	server := &testDNSServer{records: map[string][]string{"portal.test": {"192.0.2.10"}}, ttl: 300}
+	resolver := NewResolver(server.start(t))
+
+	first, err := resolver.Resolve("portal.test", DNSTypeA)
+	if err != nil {
+		t.Fatalf("Ошибка Resolve: %v", err)
+	}
+	if ttl := first.Expires.Sub(first.Refreshed); ttl != 300*time.Second {
+		t.Errorf("Resolve(): TTL %v; ожидается 5m0s", ttl)
+	}
+	if _, err = resolver.Resolve("portal.test", DNSTypeA); err != nil {
+		t.Fatalf("Ошибка Resolve: %v", err)
+	}
+	if queries := server.queries.Load(); queries != 1 {
+		t.Errorf("Resolve() до истечения TTL: %d запросов; ожидается 1", queries)
+	}
+
+	// TTL истек, а сервер недоступен
+	first.Expires = time.Now().Add(-time.Second)
+	resolver.Server = "127.0.0.1:1"
+	resolver.Timeout = time.Second
+	entry, err := resolver.Resolve("portal.test", DNSTypeA)
+	if err != nil || !entry.Stale || len(entry.Addrs) != 1 {
+		t.Errorf("Resolve() при недоступном сервере = %+v, %v; ожидается прежний ответ", entry, err)
+	}
+}
+
+// Тест для parseDNSResponse: некорректные ответы не принимаются
+func TestParseDNSResponseInvalid(t *testing.T) {
+	query, err := encodeDNSQuery(7, "example.test", DNSTypeA)
+	if err != nil {
+		t.Fatalf("Ошибка encodeDNSQuery: %v", err)
+	}
+
+	tests := [][]byte{
+		query[:8],
+		// Запрос вместо ответа: нет флага QR
+		query,
+		// Ответ с другим id
+		append([]byte{0, 8, 0x81, 0x80}, query[4:]...),
+		// Объявлен ответ, которого нет в сообщении
+		append([]byte{0, 7, 0x81, 0x80, 0, 1, 0, 1}, query[8:]...),
+	}
+
+	for _, msg := range tests {
+		if _, _, err := parseDNSResponse(msg, 7, DNSTypeA); err == nil {
+			t.Errorf("parseDNSResponse(%x) должна вернуть ошибку", msg)
+		}
+	}
+	if _, err = encodeDNSQuery(7, "bad..name", DNSTypeA); err == nil {
+		t.Error("encodeDNSQuery(bad..name) должна вернуть ошибку")
+	}
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+
+	"github.com/Max121279/routing_ripe/src/lib/cidrset"
+)
+
+// Exclusions - адреса и подсети из ignored_ips и ignored_subnets,
+// которые не должны маршрутизироваться
+type Exclusions struct {
+	entries []exclusion
+}
+
+type exclusion struct {
+	name   string
+	prefix netip.Prefix
+}
+
+// Overlap - исключение, которое пересеклось с набором подсетей
+type Overlap struct {
+	Exclusion string
+	Addresses *big.Int
+}
+
+// NewExclusions разбирает игнорируемые адреса и подсети из конфигурации
+func NewExclusions(ips, subnets []string) (*Exclusions, error) {
+	e := &Exclusions{}
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка разбора игнорируемого адреса %s: %v", ip, err)
+		}
+		addr = addr.Unmap()
+		e.entries = append(e.entries, exclusion{ip, netip.PrefixFrom(addr, addr.BitLen())})
+	}
+	for _, subnet := range subnets {
+		prefix, err := netip.ParsePrefix(subnet)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка разбора игнорируемой подсети %s: %v", subnet, err)
+		}
+		e.entries = append(e.entries, exclusion{subnet, prefix.Masked()})
+	}
+	return e, nil
+}
+
+// Apply вычитает исключения из набора подсетей. Подсети дробятся минимально:
+// остаток сводится к наименьшему числу префиксов. Возвращает также список
+// исключений, которые действительно пересеклись с набором.
+func (e *Exclusions) Apply(set *cidrset.Set) (*cidrset.Set, []Overlap) {
+	var overlaps []Overlap
+	for _, entry := range e.entries {
+		if common := set.Intersect(cidrset.New(entry.prefix)); !common.IsEmpty() {
+			overlaps = append(overlaps, Overlap{Exclusion: entry.name, Addresses: common.Count()})
+		}
+	}
+	return set.Subtract(e.set()), overlaps
+}
+
+// Verify проверяет итоговый набор подсетей: ни один префикс не должен
+// содержать игнорируемый адрес или пересекаться с игнорируемой подсетью
+func (e *Exclusions) Verify(subnets []string) error {
+	excluded := e.set()
+	for _, subnet := range subnets {
+		prefix, err := netip.ParsePrefix(subnet)
+		if err != nil {
+			return fmt.Errorf("ошибка разбора подсети %s: %v", subnet, err)
+		}
+		if excluded.Overlaps(prefix) {
+			for _, entry := range e.entries {
+				if entry.prefix.Overlaps(prefix) {
+					return fmt.Errorf("подсеть %s содержит исключенный адрес %s", subnet, entry.name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// set возвращает все исключения одним множеством
+func (e *Exclusions) set() *cidrset.Set {
+	prefixes := make([]netip.Prefix, len(e.entries))
+	for i, entry := range e.entries {
+		prefixes[i] = entry.prefix
+	}
+	return cidrset.New(prefixes...)
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Max121279/routing_ripe/src/lib/cidrset"
+)
+
+// Тест для Exclusions.Apply с игнорируемыми подсетями
+func TestExclusionsApply(t *testing.T) {
+	set, _ := cidrset.Parse("10.0.0.0/8", "192.168.0.0/24")
+	exclusions, err := NewExclusions(nil, []string{"10.1.0.0/16", "172.16.0.0/12"})
+	if err != nil {
+		t.Fatalf("Ошибка NewExclusions: %v", err)
+	}
+
+	result, overlaps := exclusions.Apply(set)
+
+	expected := []string{
+		"10.0.0.0/16", "10.2.0.0/15", "10.4.0.0/14", "10.8.0.0/13", "10.16.0.0/12",
+		"10.32.0.0/11", "10.64.0.0/10", "10.128.0.0/9", "192.168.0.0/24",
+	}
+	if !reflect.DeepEqual(result.Strings(), expected) {
+		t.Errorf("Apply() = %v; ожидается %v", result.Strings(), expected)
+	}
+	if len(overlaps) != 1 || overlaps[0].Exclusion != "10.1.0.0/16" || overlaps[0].Addresses.Int64() != 65536 {
+		t.Errorf("пересечения = %v; ожидается только 10.1.0.0/16", overlaps)
+	}
+}
+
+// Тест для NewExclusions с некорректной подсетью
+func TestNewExclusionsInvalid(t *testing.T) {
+	if _, err := NewExclusions(nil, []string{"10.0.0.0/33"}); err == nil {
+		t.Error("NewExclusions() должна вернуть ошибку для некорректной подсети")
+	}
+}
+
+// Тест для Exclusions.Apply с игнорируемыми адресами: исключенный адрес
+// не должен попасть в результат ни отдельным /32, ни внутри агрегата
+func TestExclusionsApplyIPs(t *testing.T) {
+	set, _ := cidrset.Parse("10.0.0.0/30", "2001:db8::/126")
+	exclusions, err := NewExclusions([]string{"10.0.0.1", "2001:db8::2"}, nil)
+	if err != nil {
+		t.Fatalf("Ошибка NewExclusions: %v", err)
+	}
+
+	result, _ := exclusions.Apply(set)
+
+	expected := []string{"10.0.0.0/32", "10.0.0.2/31", "2001:db8::/127", "2001:db8::3/128"}
+	if !reflect.DeepEqual(result.Strings(), expected) {
+		t.Errorf("Apply() = %v; ожидается %v", result.Strings(), expected)
+	}
+	if err = exclusions.Verify(result.Strings()); err != nil {
+		t.Errorf("Verify() = %v; ожидается nil", err)
+	}
+}
+
+// Тест для Exclusions.Verify
+func TestExclusionsVerify(t *testing.T) {
+	exclusions, _ := NewExclusions([]string{"10.134.1.24"}, []string{"192.168.0.0/16"})
+
+	tests := []struct {
+		subnets []string
+		valid   bool
+	}{
+		{[]string{"10.134.1.0/28", "10.134.1.25/32"}, true},
+		{[]string{"10.134.1.24/32"}, false},
+		{[]string{"10.0.0.0/8"}, false},
+		{[]string{"192.168.10.0/24"}, false},
+		{[]string{"192.0.0.0/8"}, false},
+	}
+
+	for _, test := range tests {
+		err := exclusions.Verify(test.subnets)
+		if (err == nil) != test.valid {
+			t.Errorf("Verify(%v) = %v; ожидается корректность %v", test.subnets, err, test.valid)
+		}
+	}
+}
@@ -1,27 +1,67 @@
 package lib
 
 import (
+	"bufio"
 	"fmt"
 	"os"
+	"strings"
 )
 
-// Функция для обновления файла подсетей
+// Функция для обновления файла подсетей. Файл перечисляет установленные
+// маршруты, поэтому он записывается во временный файл и заменяется целиком:
+// при сбое посреди записи остается прежняя версия.
 func UpdateSubnetsFile(subnets []string, filePath string) error {
+	var data strings.Builder
+	for _, subnet := range subnets {
+		data.WriteString(subnet + "\n")
+	}
 
 	// Записываем подсети в файл
-	file, err := os.Create(filePath)
+	if err := os.WriteFile(filePath+".tmp", []byte(data.String()), 0644); err != nil {
+		return fmt.Errorf("ошибка записи в файл: %v", err)
+	}
+	if err := os.Rename(filePath+".tmp", filePath); err != nil {
+		return fmt.Errorf("ошибка записи в файл: %v", err)
+	}
+
+	fmt.Printf("Файл %s успешно обновлен\n", filePath)
+	return nil
+}
+
+// ReadSubnetsFile читает подсети из файла, пропуская строки без префикса.
+// Отсутствующий файл (первый запуск) считается пустым списком.
+func ReadSubnetsFile(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("ошибка создания файла: %v", err)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка открытия файла подсетей: %v", err)
 	}
 	defer file.Close()
 
-	for _, subnet := range subnets {
-		_, err = file.WriteString(subnet + "\n")
-		if err != nil {
-			return fmt.Errorf("ошибка записи в файл: %v", err)
-		}
+	return scanSubnets(file)
+}
+
+// ReadPrefixList читает список подсетей и диапазонов, добавленных вручную:
+// по одному на строку, текст после # считается комментарием
+func ReadPrefixList(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия файла: %v", err)
 	}
+	defer file.Close()
 
-	fmt.Printf("Файл %s успешно обновлен\n", filePath)
-	return nil
+	var prefixes []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			prefixes = append(prefixes, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла: %v", err)
+	}
+	return prefixes, nil
 }
@@ -0,0 +1,29 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Тест для UpdateSubnetsFile: при ошибке записи остается прежний файл
+func TestUpdateSubnetsFileAtomic(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "subnets.txt")
+	if err := UpdateSubnetsFile([]string{"10.0.0.0/24", "10.0.1.0/24"}, filePath); err != nil {
+		t.Fatalf("Ошибка UpdateSubnetsFile: %v", err)
+	}
+
+	// Временный файл занят каталогом, поэтому запись не удается
+	if err := os.Mkdir(filePath+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateSubnetsFile([]string{"10.0.2.0/24"}, filePath); err == nil {
+		t.Error("UpdateSubnetsFile() должна вернуть ошибку")
+	}
+
+	saved, err := ReadSubnetsFile(filePath)
+	if err != nil || !reflect.DeepEqual(saved, []string{"10.0.0.0/24", "10.0.1.0/24"}) {
+		t.Errorf("ReadSubnetsFile() = %v, %v; ожидается прежний список", saved, err)
+	}
+}
@@ -0,0 +1,57 @@
+package lib
+
+import (
+	"net/netip"
+	"slices"
+
+	"github.com/Max121279/routing_ripe/src/lib/mmdb"
+)
+
+// ParseCountryDatabase возвращает сети стран countries из базы стран MMDB
+// (GeoLite2-Country, DB-IP Country). Страна сети берется из country.iso_code.
+func ParseCountryDatabase(data []byte, countries []string) (map[string]CountryResources, error) {
+	reader, err := mmdb.FromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Одни и те же данные страны используются многими сетями, поэтому
+	// каждая запись декодируется один раз
+	codes := make(map[uint]string)
+	result := make(map[string]CountryResources)
+	err = reader.Networks(func(prefix netip.Prefix, offset uint) error {
+		code, ok := codes[offset]
+		if !ok {
+			value, err := reader.Decode(offset)
+			if err != nil {
+				return err
+			}
+			code = countryCode(value)
+			codes[offset] = code
+		}
+		if !slices.Contains(countries, code) {
+			return nil
+		}
+
+		resources := result[code]
+		if prefix.Addr().Is4() {
+			resources.IPv4 = append(resources.IPv4, prefix.String())
+		} else {
+			resources.IPv6 = append(resources.IPv6, prefix.String())
+		}
+		result[code] = resources
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// countryCode извлекает country.iso_code из данных сети
+func countryCode(value any) string {
+	record, _ := value.(map[string]any)
+	country, _ := record["country"].(map[string]any)
+	code, _ := country["iso_code"].(string)
+	return code
+}
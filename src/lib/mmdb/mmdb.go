@@ -0,0 +1,395 @@
+// Package mmdb читает базы в формате MaxMind DB (GeoLite2, DB-IP).
+//
+// Файл состоит из двоичного дерева поиска по битам адреса, секции данных
+// и метаданных в конце файла. Пакет поддерживает только то, что нужно для
+// выборки сетей по стране: обход дерева, поиск адреса и декодирование данных.
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// metadataMarker предшествует метаданным в конце файла
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSeparator - размер нулевого разделителя между деревом и данными
+const dataSeparator = 16
+
+// Metadata - метаданные базы, которые нужны для чтения дерева
+type Metadata struct {
+	NodeCount    uint
+	RecordSize   uint
+	IPVersion    uint
+	DatabaseType string
+}
+
+// Reader - открытая база MMDB
+type Reader struct {
+	Metadata Metadata
+
+	buf      []byte
+	data     []byte
+	nodeSize uint
+	// ipv4Start - узел дерева IPv6, с которого начинаются адреса IPv4 (::/96)
+	ipv4Start uint
+}
+
+// Open читает базу из файла
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения базы MMDB: %v", err)
+	}
+	return FromBytes(buf)
+}
+
+// FromBytes разбирает базу, уже загруженную в память
+func FromBytes(buf []byte) (*Reader, error) {
+	start := bytes.LastIndex(buf, metadataMarker)
+	if start < 0 {
+		return nil, fmt.Errorf("не найдены метаданные MMDB")
+	}
+	start += len(metadataMarker)
+
+	value, _, err := decoder{buf[start:]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора метаданных MMDB: %v", err)
+	}
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("некорректные метаданные MMDB")
+	}
+	var metadata Metadata
+	metadata.NodeCount, _ = toUint(fields["node_count"])
+	metadata.RecordSize, _ = toUint(fields["record_size"])
+	metadata.IPVersion, _ = toUint(fields["ip_version"])
+	metadata.DatabaseType, _ = fields["database_type"].(string)
+
+	switch metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("неподдерживаемый размер записи MMDB %d", metadata.RecordSize)
+	}
+	if metadata.IPVersion != 4 && metadata.IPVersion != 6 {
+		return nil, fmt.Errorf("неподдерживаемая версия IP в MMDB %d", metadata.IPVersion)
+	}
+
+	r := &Reader{Metadata: metadata, buf: buf, nodeSize: metadata.RecordSize / 4}
+	treeSize := metadata.NodeCount * r.nodeSize
+	if treeSize+dataSeparator > uint(len(buf)) {
+		return nil, fmt.Errorf("дерево MMDB больше файла")
+	}
+	r.data = buf[treeSize+dataSeparator : start-len(metadataMarker)]
+
+	if metadata.IPVersion == 6 {
+		for i := 0; i < 96 && r.ipv4Start < metadata.NodeCount; i++ {
+			if r.ipv4Start, err = r.record(r.ipv4Start, 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r, nil
+}
+
+// Networks вызывает fn для каждой сети дерева, у которой есть данные, с
+// позицией ее данных для Decode. Адреса IPv4 в базе IPv6 возвращаются как
+// сети IPv4, их псевдонимы (::ffff:0:0/96 и 2002::/16) пропускаются.
+func (r *Reader) Networks(fn func(prefix netip.Prefix, offset uint) error) error {
+	bits := 128
+	if r.Metadata.IPVersion == 4 {
+		bits = 32
+	}
+	var addr [16]byte
+	return r.walk(0, addr, 0, bits, fn)
+}
+
+// walk обходит поддерево узла node; addr содержит первые depth бит пути
+func (r *Reader) walk(node uint, addr [16]byte, depth, bits int, fn func(netip.Prefix, uint) error) error {
+	if r.Metadata.IPVersion == 6 && depth > 0 && node == r.ipv4Start && [12]byte(addr[:12]) != [12]byte{} {
+		return nil
+	}
+	for bit := range uint(2) {
+		if bit == 1 {
+			addr[depth/8] |= 0x80 >> (depth % 8)
+		}
+		next, err := r.record(node, bit)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case next < r.Metadata.NodeCount:
+			if depth+1 >= bits {
+				return fmt.Errorf("дерево MMDB глубже %d бит", bits)
+			}
+			if err = r.walk(next, addr, depth+1, bits, fn); err != nil {
+				return err
+			}
+		case next > r.Metadata.NodeCount:
+			offset := next - r.Metadata.NodeCount - dataSeparator
+			if err = fn(r.prefix(addr, depth+1, bits), offset); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prefix строит сеть из первых length бит addr
+func (r *Reader) prefix(addr [16]byte, length, bits int) netip.Prefix {
+	if bits == 32 {
+		return netip.PrefixFrom(netip.AddrFrom4([4]byte(addr[:4])), length)
+	}
+	ip := netip.AddrFrom16(addr)
+	if length >= 96 && [12]byte(addr[:12]) == [12]byte{} {
+		return netip.PrefixFrom(netip.AddrFrom4([4]byte(addr[12:])), length-96)
+	}
+	return netip.PrefixFrom(ip, length)
+}
+
+// Lookup возвращает данные сети, в которую входит адрес, или nil
+func (r *Reader) Lookup(addr netip.Addr) (any, error) {
+	if addr.Is4() && r.Metadata.IPVersion == 6 {
+		// Адреса IPv4 лежат в дереве IPv6 в подсети ::/96
+		var ip [16]byte
+		v4 := addr.As4()
+		copy(ip[12:], v4[:])
+		addr = netip.AddrFrom16(ip)
+	} else if addr.Is6() && r.Metadata.IPVersion == 4 {
+		return nil, fmt.Errorf("база MMDB содержит только IPv4")
+	}
+	raw := addr.AsSlice()
+
+	node := uint(0)
+	for i := 0; i < len(raw)*8 && node < r.Metadata.NodeCount; i++ {
+		var err error
+		if node, err = r.record(node, uint(raw[i/8]>>(7-i%8))&1); err != nil {
+			return nil, err
+		}
+	}
+	if node <= r.Metadata.NodeCount {
+		return nil, nil
+	}
+	return r.Decode(node - r.Metadata.NodeCount - dataSeparator)
+}
+
+// Decode декодирует данные по позиции из Networks
+func (r *Reader) Decode(offset uint) (any, error) {
+	value, _, err := decoder{r.data}.decode(offset, 0)
+	return value, err
+}
+
+// record возвращает левую (bit = 0) или правую запись узла
+func (r *Reader) record(node, bit uint) (uint, error) {
+	offset := node * r.nodeSize
+	if offset+r.nodeSize > uint(len(r.buf)) {
+		return 0, fmt.Errorf("узел MMDB %d за пределами файла", node)
+	}
+	b := r.buf[offset : offset+r.nodeSize]
+
+	switch r.Metadata.RecordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:])), nil
+	}
+}
+
+// Типы данных MMDB
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth ограничивает вложенность данных, чтобы испорченный файл
+// не привел к бесконечной рекурсии через указатели
+const maxDepth = 32
+
+// decoder декодирует секцию данных. Указатели отсчитываются от ее начала.
+type decoder struct {
+	buf []byte
+}
+
+// decode возвращает значение по позиции offset и позицию после него
+func (d decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("слишком глубокая вложенность данных MMDB")
+	}
+	kind, size, offset, err := d.header(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if kind == typePointer {
+		value, _, err := d.decode(size, depth+1)
+		return value, offset, err
+	}
+	if kind == typeMap {
+		values := make(map[string]any, min(size, 64))
+		for range size {
+			var key, value any
+			if key, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("ключ словаря MMDB не строка")
+			}
+			if value, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			values[name] = value
+		}
+		return values, offset, nil
+	}
+	if kind == typeArray {
+		values := make([]any, 0, min(size, 1024))
+		for range size {
+			var value any
+			if value, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			values = append(values, value)
+		}
+		return values, offset, nil
+	}
+	if kind == typeBool {
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, fmt.Errorf("данные MMDB за пределами файла")
+	}
+	raw := d.buf[offset : offset+size]
+	offset += size
+	switch kind {
+	case typeString:
+		return string(raw), offset, nil
+	case typeBytes:
+		return bytes.Clone(raw), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("некорректный размер double в MMDB")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("некорректный размер float в MMDB")
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(raw)), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("некорректный размер целого в MMDB")
+		}
+		var value uint64
+		for _, b := range raw {
+			value = value<<8 | uint64(b)
+		}
+		return value, offset, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("некорректный размер целого в MMDB")
+		}
+		var value uint32
+		for _, b := range raw {
+			value = value<<8 | uint32(b)
+		}
+		// Короткие значения не расширяются знаком, как и в libmaxminddb
+		return int64(int32(value)), offset, nil
+	case typeUint128:
+		// Значения uint128 для выборки по стране не нужны
+		return bytes.Clone(raw), offset, nil
+	}
+	return nil, 0, fmt.Errorf("неизвестный тип данных MMDB %d", kind)
+}
+
+// header разбирает управляющий байт и возвращает тип, размер (для указателя -
+// позицию, на которую он указывает) и позицию начала значения
+func (d decoder) header(offset uint) (kind, size, next uint, err error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, fmt.Errorf("данные MMDB за пределами файла")
+	}
+	control := d.buf[offset]
+	offset++
+	kind = uint(control >> 5)
+
+	if kind == typePointer {
+		length := uint(control>>3&0x3) + 1
+		if offset+length > uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("данные MMDB за пределами файла")
+		}
+		var pointer uint
+		if length < 4 {
+			pointer = uint(control & 0x7)
+		}
+		for _, b := range d.buf[offset : offset+length] {
+			pointer = pointer<<8 | uint(b)
+		}
+		switch length {
+		case 2:
+			pointer += 2048
+		case 3:
+			pointer += 526336
+		}
+		return kind, pointer, offset + length, nil
+	}
+
+	if kind == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("данные MMDB за пределами файла")
+		}
+		kind = uint(d.buf[offset]) + 7
+		offset++
+	}
+
+	size = uint(control & 0x1f)
+	if size >= 29 {
+		length := size - 28
+		if offset+length > uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("данные MMDB за пределами файла")
+		}
+		var extra uint
+		for _, b := range d.buf[offset : offset+length] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += length
+		size = []uint{29, 285, 65821}[length-1] + extra
+	}
+	return kind, size, offset, nil
+}
+
+// toUint приводит целое значение из метаданных к uint
+func toUint(value any) (uint, bool) {
+	switch v := value.(type) {
+	case uint64:
+		return uint(v), true
+	case int64:
+		return uint(v), v >= 0
+	}
+	return 0, false
+}
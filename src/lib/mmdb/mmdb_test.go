@@ -0,0 +1,238 @@
+package mmdb
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// testRecord - запись узла тестового дерева: следующий узел или данные
+type testRecord struct {
+	node int
+	data int
+	set  bool
+}
+
+// testTree строит дерево поиска для тестовой базы
+type testTree struct {
+	nodes [][2]testRecord
+}
+
+// walk проходит первые length бит addr, создавая недостающие узлы,
+// и возвращает последний узел и бит, запись которого задает сеть
+func (t *testTree) walk(addr [16]byte, length int) (int, int) {
+	if len(t.nodes) == 0 {
+		t.nodes = append(t.nodes, [2]testRecord{})
+	}
+	node := 0
+	for i := 0; i < length-1; i++ {
+		bit := int(addr[i/8]>>(7-i%8)) & 1
+		if !t.nodes[node][bit].set {
+			t.nodes = append(t.nodes, [2]testRecord{})
+			t.nodes[node][bit] = testRecord{node: len(t.nodes) - 1, data: -1, set: true}
+		}
+		node = t.nodes[node][bit].node
+	}
+	return node, int(addr[(length-1)/8]>>(7-(length-1)%8)) & 1
+}
+
+// insert связывает сеть с данными по позиции data
+func (t *testTree) insert(prefix string, data int) {
+	p := netip.MustParsePrefix(prefix)
+	addr, length := p.Addr().As16(), p.Bits()
+	if p.Addr().Is4() {
+		addr = [16]byte{}
+		v4 := p.Addr().As4()
+		copy(addr[12:], v4[:])
+		length += 96
+	}
+	node, bit := t.walk(addr, length)
+	t.nodes[node][bit] = testRecord{data: data, set: true}
+}
+
+// link направляет сеть prefix в поддерево, которое начинается сетью target
+func (t *testTree) link(prefix, target string) {
+	// Узел на глубине target.Bits() - тот, из которого выходит запись следующего бита
+	p := netip.MustParsePrefix(target)
+	node, _ := t.walk(p.Addr().As16(), p.Bits()+1)
+	from := netip.MustParsePrefix(prefix)
+	linkNode, linkBit := t.walk(from.Addr().As16(), from.Bits())
+	t.nodes[linkNode][linkBit] = testRecord{node: node, data: -1, set: true}
+}
+
+// build собирает файл базы с записями размера recordSize
+func (t *testTree) build(recordSize int, data []byte, metadata []byte) []byte {
+	count := len(t.nodes)
+	value := func(r testRecord) uint32 {
+		switch {
+		case !r.set:
+			return uint32(count)
+		case r.data >= 0:
+			return uint32(count + dataSeparator + r.data)
+		}
+		return uint32(r.node)
+	}
+
+	var buf []byte
+	for _, node := range t.nodes {
+		left, right := value(node[0]), value(node[1])
+		switch recordSize {
+		case 24:
+			buf = append(buf, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			buf = append(buf, byte(left>>16), byte(left>>8), byte(left),
+				byte(left>>20&0xf0)|byte(right>>24&0x0f), byte(right>>16), byte(right>>8), byte(right))
+		default:
+			buf = binary.BigEndian.AppendUint32(buf, left)
+			buf = binary.BigEndian.AppendUint32(buf, right)
+		}
+	}
+	buf = append(buf, make([]byte, dataSeparator)...)
+	buf = append(buf, data...)
+	buf = append(buf, metadataMarker...)
+	return append(buf, metadata...)
+}
+
+// Кодирование данных MMDB для тестовой базы
+func encodeHeader(kind, size int) []byte {
+	if kind <= typeMap {
+		return []byte{byte(kind<<5 | size)}
+	}
+	return []byte{byte(size), byte(kind - 7)}
+}
+
+func encodeString(s string) []byte {
+	return append(encodeHeader(typeString, len(s)), s...)
+}
+
+func encodeUint(kind int, value uint64) []byte {
+	var raw []byte
+	for ; value > 0; value >>= 8 {
+		raw = append([]byte{byte(value)}, raw...)
+	}
+	return append(encodeHeader(kind, len(raw)), raw...)
+}
+
+func encodeMap(pairs ...[]byte) []byte {
+	result := encodeHeader(typeMap, len(pairs)/2)
+	for _, pair := range pairs {
+		result = append(result, pair...)
+	}
+	return result
+}
+
+func encodePointer(offset int) []byte {
+	return []byte{byte(typePointer<<5 | offset>>8), byte(offset)}
+}
+
+// testDatabase возвращает базу стран: сеть RU, сеть BY, которая ссылается
+// на данные указателем, и псевдоним ::ffff:0:0/96 для адресов IPv4
+func testDatabase(t *testing.T, recordSize int) []byte {
+	t.Helper()
+	country := encodeMap(encodeString("iso_code"), encodeString("RU"))
+	ru := encodeMap(encodeString("country"), country)
+	countryBY := len(ru)
+	data := append(ru, encodeMap(encodeString("iso_code"), encodeString("BY"))...)
+	by := len(data)
+	data = append(data, encodeMap(encodeString("country"), encodePointer(countryBY),
+		encodeString("is_anycast"), encodeHeader(typeBool, 1))...)
+
+	tree := &testTree{}
+	tree.insert("5.8.0.0/16", 0)
+	tree.insert("31.40.0.0/14", by)
+	tree.insert("2a00:1fa0::/29", 0)
+	tree.link("::ffff:0:0/96", "::/96")
+
+	metadata := encodeMap(
+		encodeString("node_count"), encodeUint(typeUint32, uint64(len(tree.nodes))),
+		encodeString("record_size"), encodeUint(typeUint16, uint64(recordSize)),
+		encodeString("ip_version"), encodeUint(typeUint16, 6),
+		encodeString("database_type"), encodeString("GeoLite2-Country"),
+		encodeString("build_epoch"), encodeUint(typeUint64, 1700000000),
+	)
+	return tree.build(recordSize, data, metadata)
+}
+
+// Тест для Networks и Lookup с разными размерами записей
+func TestReaderNetworks(t *testing.T) {
+	expected := map[string]string{
+		"5.8.0.0/16":     "RU",
+		"31.40.0.0/14":   "BY",
+		"2a00:1fa0::/29": "RU",
+	}
+
+	for _, recordSize := range []int{24, 28, 32} {
+		reader, err := FromBytes(testDatabase(t, recordSize))
+		if err != nil {
+			t.Fatalf("Ошибка FromBytes(%d): %v", recordSize, err)
+		}
+		if reader.Metadata.DatabaseType != "GeoLite2-Country" {
+			t.Errorf("Metadata = %+v; ожидается GeoLite2-Country", reader.Metadata)
+		}
+
+		result := make(map[string]string)
+		err = reader.Networks(func(prefix netip.Prefix, offset uint) error {
+			value, err := reader.Decode(offset)
+			if err != nil {
+				return err
+			}
+			country := value.(map[string]any)["country"].(map[string]any)
+			result[prefix.String()] = country["iso_code"].(string)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Ошибка Networks(%d): %v", recordSize, err)
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Networks(%d) = %v; ожидается %v", recordSize, result, expected)
+		}
+
+		for addr, code := range map[string]string{"5.8.1.1": "RU", "31.43.255.255": "BY", "8.8.8.8": ""} {
+			value, err := reader.Lookup(netip.MustParseAddr(addr))
+			if err != nil {
+				t.Fatalf("Ошибка Lookup(%s): %v", addr, err)
+			}
+			var result string
+			if value != nil {
+				result = value.(map[string]any)["country"].(map[string]any)["iso_code"].(string)
+			}
+			if result != code {
+				t.Errorf("Lookup(%s) = %v; ожидается %q", addr, value, code)
+			}
+		}
+	}
+}
+
+// Тест для decoder: расширенные типы, длинные строки и отрицательные числа
+func TestDecode(t *testing.T) {
+	long := string(slices.Repeat([]byte("a"), 300))
+	tests := []struct {
+		data     []byte
+		expected any
+	}{
+		{encodeString("RU"), "RU"},
+		{append([]byte{byte(typeString<<5 | 30), 0, 15}, long...), long},
+		{encodeUint(typeUint64, 1<<40), uint64(1 << 40)},
+		{append(encodeHeader(typeInt32, 4), 0xff, 0xff, 0xff, 0xfe), int64(-2)},
+		{append(encodeHeader(typeInt32, 2), 0x01, 0x00), int64(256)},
+		{encodeHeader(typeBool, 1), true},
+		{slices.Concat(encodeHeader(typeArray, 2), encodeString("a"), encodeString("b")), []any{"a", "b"}},
+	}
+
+	for _, test := range tests {
+		value, _, err := decoder{test.data}.decode(0, 0)
+		if err != nil || !reflect.DeepEqual(value, test.expected) {
+			t.Errorf("decode(%x) = %v, %v; ожидается %v", test.data, value, err, test.expected)
+		}
+	}
+
+	// Указатель на самого себя не должен приводить к бесконечной рекурсии
+	if _, _, err := (decoder{encodePointer(0)}).decode(0, 0); err == nil {
+		t.Error("decode() должна вернуть ошибку для зацикленного указателя")
+	}
+	if _, err := FromBytes([]byte("not a database")); err == nil {
+		t.Error("FromBytes() должна вернуть ошибку без метаданных")
+	}
+}
@@ -0,0 +1,365 @@
+//go:build linux
+
+package lib
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// netlinkBatchSize - сколько сообщений отправляется ядру за один вызов
+const netlinkBatchSize = 256
+
+// netlinkRouter отправляет маршруты в ядро через rtnetlink пакетами
+type netlinkRouter struct {
+	fd  int
+	seq uint32
+}
+
+// newNetlinkRouter открывает сокет NETLINK_ROUTE
+func newNetlinkRouter() (*netlinkRouter, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия netlink сокета: %v", err)
+	}
+	if err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("ошибка привязки netlink сокета: %v", err)
+	}
+	// Ответы на целый пакет должны поместиться в буфер приема
+	_ = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, 1<<20)
+
+	return &netlinkRouter{fd: fd}, nil
+}
+
+func (r *netlinkRouter) close() {
+	syscall.Close(r.fd)
+}
+
+// netlinkRoute - параметры маршрута, разрешенные для сообщений netlink
+type netlinkRoute struct {
+	ifIndex   int
+	gateway   netip.Addr
+	metric    uint32
+	table     uint32
+	protocol  uint8
+	routeType uint8
+}
+
+// netlinkRouteTypes сопоставляет типы маршрутов с RTN_*
+var netlinkRouteTypes = map[string]uint8{
+	"unicast":     syscall.RTN_UNICAST,
+	"blackhole":   syscall.RTN_BLACKHOLE,
+	"unreachable": syscall.RTN_UNREACHABLE,
+	"prohibit":    syscall.RTN_PROHIBIT,
+}
+
+// newNetlinkRoute находит индекс интерфейса, разбирает адрес шлюза
+// и переводит остальные параметры в значения netlink
+func newNetlinkRoute(options RouteOptions, v6 bool) (netlinkRoute, error) {
+	route := netlinkRoute{
+		metric:    uint32(options.Metric),
+		table:     uint32(options.table()),
+		protocol:  uint8(options.protocol()),
+		routeType: syscall.RTN_UNICAST,
+	}
+	if !options.unicast() {
+		route.routeType = netlinkRouteTypes[options.Type]
+		return route, nil
+	}
+
+	if iface := options.iface(v6); iface != "" {
+		link, err := net.InterfaceByName(iface)
+		if err != nil {
+			return route, fmt.Errorf("интерфейс %s не найден: %v", iface, err)
+		}
+		route.ifIndex = link.Index
+	}
+	if gateway := options.gateway(v6); gateway != "" {
+		addr, err := netip.ParseAddr(gateway)
+		if err != nil || addr.Is6() != v6 {
+			return route, fmt.Errorf("некорректный адрес шлюза %s", gateway)
+		}
+		route.gateway = addr
+	}
+	if route.ifIndex == 0 && !route.gateway.IsValid() {
+		return route, fmt.Errorf("не задан ни интерфейс, ни шлюз")
+	}
+	return route, nil
+}
+
+// netlinkRoutes добавляет или удаляет маршруты через netlink.
+// Ошибка возвращается, только если netlink недоступен целиком.
+func netlinkRoutes(subnets []string, options RouteOptions, v6, add bool) ([]RouteResult, error) {
+	route, err := newNetlinkRoute(options, v6)
+	if err != nil {
+		return nil, err
+	}
+
+	router, err := newNetlinkRouter()
+	if err != nil {
+		return nil, err
+	}
+	defer router.close()
+
+	results := make([]RouteResult, len(subnets))
+	for start := 0; start < len(subnets); start += netlinkBatchSize {
+		end := min(start+netlinkBatchSize, len(subnets))
+		if err = router.sendBatch(subnets[start:end], results[start:end], route, add); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// sendBatch отправляет пакет сообщений одним вызовом и собирает подтверждения
+func (r *netlinkRouter) sendBatch(subnets []string, results []RouteResult, route netlinkRoute, add bool) error {
+	var buf []byte
+	pending := make(map[uint32]int, len(subnets))
+
+	for i, subnet := range subnets {
+		results[i].Subnet = subnet
+		prefix, err := netip.ParsePrefix(subnet)
+		if err != nil {
+			results[i].Err = fmt.Errorf("ошибка разбора подсети: %v", err)
+			continue
+		}
+		r.seq++
+		pending[r.seq] = i
+		buf = append(buf, routeMessage(r.seq, prefix.Masked(), route, add)...)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := syscall.Sendto(r.fd, buf, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return fmt.Errorf("ошибка отправки в netlink: %v", err)
+	}
+
+	rb := make([]byte, 1<<16)
+	for len(pending) > 0 {
+		n, _, err := syscall.Recvfrom(r.fd, rb, 0)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения из netlink: %v", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(rb[:n])
+		if err != nil {
+			return fmt.Errorf("ошибка разбора ответа netlink: %v", err)
+		}
+		for _, msg := range msgs {
+			i, ok := pending[msg.Header.Seq]
+			if !ok || msg.Header.Type != syscall.NLMSG_ERROR || len(msg.Data) < 4 {
+				continue
+			}
+			delete(pending, msg.Header.Seq)
+			code := int32(binary.NativeEndian.Uint32(msg.Data[:4]))
+			// Маршрут уже есть при добавлении или уже отсутствует при удалении
+			if code == 0 || (add && code == -int32(syscall.EEXIST)) || (!add && code == -int32(syscall.ESRCH)) {
+				continue
+			}
+			results[i].Err = syscall.Errno(-code)
+		}
+	}
+
+	return nil
+}
+
+// routeMessage формирует сообщение RTM_NEWROUTE/RTM_DELROUTE, аналогичное
+// `ip route add|del [type] <prefix> [via <gateway>] [dev <iface>] [metric] table proto`.
+// При удалении передаются те же тип, таблица, протокол и метрика, чтобы
+// ядро удалило именно наш маршрут.
+func routeMessage(seq uint32, prefix netip.Prefix, route netlinkRoute, add bool) []byte {
+	msgType := uint16(syscall.RTM_DELROUTE)
+	flags := uint16(syscall.NLM_F_REQUEST | syscall.NLM_F_ACK)
+	rtm := syscall.RtMsg{
+		Family:   syscall.AF_INET,
+		Dst_len:  uint8(prefix.Bits()),
+		Table:    syscall.RT_TABLE_UNSPEC,
+		Protocol: route.protocol,
+		Scope:    syscall.RT_SCOPE_NOWHERE,
+		Type:     route.routeType,
+	}
+	if prefix.Addr().Is6() {
+		rtm.Family = syscall.AF_INET6
+	}
+	if route.table < 256 {
+		rtm.Table = uint8(route.table)
+	}
+	if add {
+		msgType = syscall.RTM_NEWROUTE
+		flags |= syscall.NLM_F_CREATE | syscall.NLM_F_EXCL
+		rtm.Scope = syscall.RT_SCOPE_UNIVERSE
+		if route.routeType == syscall.RTN_UNICAST && !route.gateway.IsValid() {
+			rtm.Scope = syscall.RT_SCOPE_LINK
+		}
+	}
+
+	body := []byte{rtm.Family, rtm.Dst_len, rtm.Src_len, rtm.Tos, rtm.Table, rtm.Protocol, rtm.Scope, rtm.Type}
+	body = binary.NativeEndian.AppendUint32(body, rtm.Flags)
+	body = appendRtAttr(body, syscall.RTA_DST, prefix.Addr().AsSlice())
+	body = appendRtAttr(body, syscall.RTA_TABLE, binary.NativeEndian.AppendUint32(nil, route.table))
+	if route.gateway.IsValid() {
+		body = appendRtAttr(body, syscall.RTA_GATEWAY, route.gateway.AsSlice())
+	}
+	if route.ifIndex != 0 {
+		body = appendRtAttr(body, syscall.RTA_OIF, binary.NativeEndian.AppendUint32(nil, uint32(route.ifIndex)))
+	}
+	if route.metric != 0 {
+		body = appendRtAttr(body, syscall.RTA_PRIORITY, binary.NativeEndian.AppendUint32(nil, route.metric))
+	}
+
+	msg := make([]byte, 0, syscall.SizeofNlMsghdr+len(body))
+	msg = binary.NativeEndian.AppendUint32(msg, uint32(syscall.SizeofNlMsghdr+len(body)))
+	msg = binary.NativeEndian.AppendUint16(msg, msgType)
+	msg = binary.NativeEndian.AppendUint16(msg, flags)
+	msg = binary.NativeEndian.AppendUint32(msg, seq)
+	msg = binary.NativeEndian.AppendUint32(msg, 0)
+	return append(msg, body...)
+}
+
+// appendRtAttr добавляет атрибут rtattr с выравниванием на 4 байта
+func appendRtAttr(b []byte, attrType uint16, data []byte) []byte {
+	length := syscall.SizeofRtAttr + len(data)
+	b = binary.NativeEndian.AppendUint16(b, uint16(length))
+	b = binary.NativeEndian.AppendUint16(b, attrType)
+	b = append(b, data...)
+	for length%4 != 0 {
+		b = append(b, 0)
+		length++
+	}
+	return b
+}
+
+// netlinkAvailable проверяет, можно ли открыть netlink сокет
+func netlinkAvailable() bool {
+	router, err := newNetlinkRouter()
+	if err != nil {
+		return false
+	}
+	router.close()
+	return true
+}
+
+// netlinkListRoutes возвращает маршруты указанного семейства адресов
+// с таблицей, протоколом, типом, метрикой, интерфейсом и шлюзом профиля
+func netlinkListRoutes(options RouteOptions, v6 bool) ([]string, error) {
+	route, err := newNetlinkRoute(options, v6)
+	if err != nil {
+		return nil, err
+	}
+	family := syscall.AF_INET
+	if v6 {
+		family = syscall.AF_INET6
+	}
+
+	router, err := newNetlinkRouter()
+	if err != nil {
+		return nil, err
+	}
+	defer router.close()
+
+	var subnets []string
+	err = router.dump(syscall.RTM_GETROUTE, func(msg syscall.NetlinkMessage) {
+		if msg.Header.Type != syscall.RTM_NEWROUTE || len(msg.Data) < syscall.SizeofRtMsg {
+			return
+		}
+		rtm := msg.Data[:syscall.SizeofRtMsg]
+		rtmFamily, dstLen, table, protocol, routeType := int(rtm[0]), int(rtm[1]), uint32(rtm[4]), rtm[5], rtm[7]
+		if rtmFamily != family || protocol != route.protocol || routeType != route.routeType || dstLen == 0 {
+			return
+		}
+
+		attrs, err := syscall.ParseNetlinkRouteAttr(&msg)
+		if err != nil {
+			return
+		}
+		var dst, gateway []byte
+		oif := 0
+		var metric uint32
+		for _, attr := range attrs {
+			switch attr.Attr.Type {
+			case syscall.RTA_DST:
+				dst = attr.Value
+			case syscall.RTA_GATEWAY:
+				gateway = attr.Value
+			case syscall.RTA_OIF:
+				oif = int(binary.NativeEndian.Uint32(attr.Value))
+			case syscall.RTA_TABLE:
+				table = binary.NativeEndian.Uint32(attr.Value)
+			case syscall.RTA_PRIORITY:
+				metric = binary.NativeEndian.Uint32(attr.Value)
+			}
+		}
+		if table != route.table || (route.metric != 0 && metric != route.metric) || (route.ifIndex != 0 && oif != route.ifIndex) {
+			return
+		}
+		if gw, _ := netip.AddrFromSlice(gateway); route.gateway.IsValid() && gw != route.gateway {
+			return
+		}
+
+		addr, ok := netip.AddrFromSlice(dst)
+		if !ok {
+			return
+		}
+		subnets = append(subnets, netip.PrefixFrom(addr, dstLen).String())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return subnets, nil
+}
+
+// dump отправляет запрос с флагом NLM_F_DUMP и вызывает fn для каждого
+// сообщения ответа до NLMSG_DONE
+func (r *netlinkRouter) dump(msgType uint16, fn func(msg syscall.NetlinkMessage)) error {
+	r.seq++
+	seq := r.seq
+
+	// rtgenmsg с семейством AF_UNSPEC, выровненный до 4 байт
+	req := make([]byte, 0, syscall.SizeofNlMsghdr+4)
+	req = binary.NativeEndian.AppendUint32(req, uint32(syscall.SizeofNlMsghdr+4))
+	req = binary.NativeEndian.AppendUint16(req, msgType)
+	req = binary.NativeEndian.AppendUint16(req, syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	req = binary.NativeEndian.AppendUint32(req, seq)
+	req = binary.NativeEndian.AppendUint32(req, 0)
+	req = append(req, syscall.AF_UNSPEC, 0, 0, 0)
+
+	if err := syscall.Sendto(r.fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return fmt.Errorf("ошибка отправки в netlink: %v", err)
+	}
+
+	rb := make([]byte, 1<<16)
+	for {
+		n, _, err := syscall.Recvfrom(r.fd, rb, 0)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения из netlink: %v", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(rb[:n])
+		if err != nil {
+			return fmt.Errorf("ошибка разбора ответа netlink: %v", err)
+		}
+		for _, msg := range msgs {
+			if msg.Header.Seq != seq {
+				continue
+			}
+			switch msg.Header.Type {
+			case syscall.NLMSG_DONE:
+				return nil
+			case syscall.NLMSG_ERROR:
+				if len(msg.Data) >= 4 {
+					if code := int32(binary.NativeEndian.Uint32(msg.Data[:4])); code != 0 {
+						return syscall.Errno(-code)
+					}
+				}
+				return nil
+			default:
+				fn(msg)
+			}
+		}
+	}
+}
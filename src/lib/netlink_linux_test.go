@@ -0,0 +1,136 @@
+//go:build linux
+
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"slices"
+	"syscall"
+	"testing"
+)
+
+// Кодирование полей сообщений netlink для ожидаемых значений
+func nlUint16(value uint16) []byte { return binary.NativeEndian.AppendUint16(nil, value) }
+
+func nlUint32(value uint32) []byte { return binary.NativeEndian.AppendUint32(nil, value) }
+
+// nlAttr кодирует rtattr без учета выравнивания: данные тестов кратны 4 байтам
+func nlAttr(attrType uint16, data []byte) []byte {
+	return slices.Concat(nlUint16(uint16(4+len(data))), nlUint16(attrType), data)
+}
+
+// nlHeader кодирует nlmsghdr для тела длины bodyLen
+func nlHeader(bodyLen int, msgType, flags uint16, seq uint32) []byte {
+	return slices.Concat(nlUint32(uint32(16+bodyLen)), nlUint16(msgType), nlUint16(flags), nlUint32(seq), nlUint32(0))
+}
+
+// Тест для routeMessage: байты сообщений для IPv4 и IPv6, со шлюзом и без,
+// с таблицей больше 255 и метрикой
+func TestRouteMessage(t *testing.T) {
+	addFlags := uint16(syscall.NLM_F_REQUEST | syscall.NLM_F_ACK | syscall.NLM_F_CREATE | syscall.NLM_F_EXCL)
+	delFlags := uint16(syscall.NLM_F_REQUEST | syscall.NLM_F_ACK)
+
+	tests := []struct {
+		name    string
+		prefix  string
+		route   netlinkRoute
+		add     bool
+		msgType uint16
+		flags   uint16
+		rtmsg   []byte
+		attrs   [][]byte
+	}{
+		{
+			name:    "IPv4 через интерфейс",
+			prefix:  "10.0.0.0/24",
+			route:   netlinkRoute{ifIndex: 3, table: 254, protocol: 4, routeType: syscall.RTN_UNICAST},
+			add:     true,
+			msgType: syscall.RTM_NEWROUTE,
+			flags:   addFlags,
+			rtmsg:   []byte{syscall.AF_INET, 24, 0, 0, 254, 4, syscall.RT_SCOPE_LINK, syscall.RTN_UNICAST, 0, 0, 0, 0},
+			attrs: [][]byte{
+				nlAttr(syscall.RTA_DST, []byte{10, 0, 0, 0}),
+				nlAttr(syscall.RTA_TABLE, nlUint32(254)),
+				nlAttr(syscall.RTA_OIF, nlUint32(3)),
+			},
+		},
+		{
+			name:   "IPv4 через шлюз с метрикой",
+			prefix: "192.168.0.0/16",
+			route: netlinkRoute{gateway: netip.MustParseAddr("10.0.0.1"), ifIndex: 2, metric: 50,
+				table: 100, protocol: 4, routeType: syscall.RTN_UNICAST},
+			add:     true,
+			msgType: syscall.RTM_NEWROUTE,
+			flags:   addFlags,
+			rtmsg:   []byte{syscall.AF_INET, 16, 0, 0, 100, 4, syscall.RT_SCOPE_UNIVERSE, syscall.RTN_UNICAST, 0, 0, 0, 0},
+			attrs: [][]byte{
+				nlAttr(syscall.RTA_DST, []byte{192, 168, 0, 0}),
+				nlAttr(syscall.RTA_TABLE, nlUint32(100)),
+				nlAttr(syscall.RTA_GATEWAY, []byte{10, 0, 0, 1}),
+				nlAttr(syscall.RTA_OIF, nlUint32(2)),
+				nlAttr(syscall.RTA_PRIORITY, nlUint32(50)),
+			},
+		},
+		{
+			name:   "IPv6 через шлюз в таблице 1000",
+			prefix: "2001:db8::/32",
+			route: netlinkRoute{gateway: netip.MustParseAddr("fe80::1"), metric: 100,
+				table: 1000, protocol: 4, routeType: syscall.RTN_UNICAST},
+			add:     true,
+			msgType: syscall.RTM_NEWROUTE,
+			flags:   addFlags,
+			rtmsg:   []byte{syscall.AF_INET6, 32, 0, 0, syscall.RT_TABLE_UNSPEC, 4, syscall.RT_SCOPE_UNIVERSE, syscall.RTN_UNICAST, 0, 0, 0, 0},
+			attrs: [][]byte{
+				nlAttr(syscall.RTA_DST, netip.MustParseAddr("2001:db8::").AsSlice()),
+				nlAttr(syscall.RTA_TABLE, nlUint32(1000)),
+				nlAttr(syscall.RTA_GATEWAY, netip.MustParseAddr("fe80::1").AsSlice()),
+				nlAttr(syscall.RTA_PRIORITY, nlUint32(100)),
+			},
+		},
+		{
+			name:    "удаление blackhole IPv6",
+			prefix:  "2a00:1fa0::/29",
+			route:   netlinkRoute{table: 254, protocol: 4, routeType: syscall.RTN_BLACKHOLE},
+			add:     false,
+			msgType: syscall.RTM_DELROUTE,
+			flags:   delFlags,
+			rtmsg:   []byte{syscall.AF_INET6, 29, 0, 0, 254, 4, syscall.RT_SCOPE_NOWHERE, syscall.RTN_BLACKHOLE, 0, 0, 0, 0},
+			attrs: [][]byte{
+				nlAttr(syscall.RTA_DST, netip.MustParseAddr("2a00:1fa0::").AsSlice()),
+				nlAttr(syscall.RTA_TABLE, nlUint32(254)),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		body := slices.Concat(append([][]byte{test.rtmsg}, test.attrs...)...)
+		expected := append(nlHeader(len(body), test.msgType, test.flags, 7), body...)
+		msg := routeMessage(7, netip.MustParsePrefix(test.prefix), test.route, test.add)
+		if !bytes.Equal(msg, expected) {
+			t.Errorf("routeMessage(%s) = %x; ожидается %x", test.name, msg, expected)
+		}
+	}
+}
+
+// Тест для appendRtAttr: длина без выравнивания, данные дополняются нулями до 4 байт
+func TestAppendRtAttr(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		expected []byte
+	}{
+		{nil, slices.Concat(nlUint16(4), nlUint16(1))},
+		{[]byte{0xaa}, slices.Concat(nlUint16(5), nlUint16(1), []byte{0xaa, 0, 0, 0})},
+		{[]byte{1, 2, 3}, slices.Concat(nlUint16(7), nlUint16(1), []byte{1, 2, 3, 0})},
+		{[]byte{1, 2, 3, 4}, slices.Concat(nlUint16(8), nlUint16(1), []byte{1, 2, 3, 4})},
+	}
+
+	for _, test := range tests {
+		result := appendRtAttr([]byte{0xff}, 1, test.data)
+		expected := append([]byte{0xff}, test.expected...)
+		if !bytes.Equal(result, expected) {
+			t.Errorf("appendRtAttr(%x) = %x; ожидается %x", test.data, result, expected)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package lib
+
+import "errors"
+
+// netlinkRoutes недоступен вне Linux, используется запасной путь через ip
+func netlinkRoutes(subnets []string, options RouteOptions, v6, add bool) ([]RouteResult, error) {
+	return nil, errors.New("netlink поддерживается только в Linux")
+}
+
+func netlinkAvailable() bool { return false }
+
+func netlinkListRoutes(options RouteOptions, v6 bool) ([]string, error) {
+	return nil, errors.New("netlink поддерживается только в Linux")
+}
+
+// WatchLinks недоступен вне Linux: события об интерфейсах приходят через netlink
+func WatchLinks(names []string, stop <-chan struct{}) (<-chan string, error) {
+	return nil, errors.New("слежение за интерфейсами поддерживается только в Linux")
+}
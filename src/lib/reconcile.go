@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// DiffSubnets сравнивает предыдущий и новый наборы подсетей и возвращает
+// подсети, которые нужно добавить, удалить и оставить без изменений
+func DiffSubnets(oldSubnets, newSubnets []string) (added, removed, kept []string) {
+	oldSet := make(map[string]bool, len(oldSubnets))
+	for _, subnet := range oldSubnets {
+		oldSet[subnet] = true
+	}
+	newSet := make(map[string]bool, len(newSubnets))
+	for _, subnet := range newSubnets {
+		newSet[subnet] = true
+	}
+
+	for _, subnet := range newSubnets {
+		if oldSet[subnet] {
+			kept = append(kept, subnet)
+		} else {
+			added = append(added, subnet)
+		}
+	}
+	for _, subnet := range oldSubnets {
+		if !newSet[subnet] {
+			removed = append(removed, subnet)
+		}
+	}
+
+	return added, removed, kept
+}
+
+// ReconcileRoutes приводит установленные маршруты к новому набору подсетей.
+// Удаляются только исчезнувшие подсети, добавляются только новые,
+// неизменившиеся маршруты не трогаются, если они действительно установлены.
+// Бэкенд с RouteReplacer получает новый набор целиком. В файл подсетей записываются маршруты, которые
+// действительно установлены: подсеть, которую не удалось добавить, будет
+// добавлена при следующем обновлении, а не удаленная - удалена.
+func ReconcileRoutes(backend RouteBackend, filePath string, subnets []string) error {
+	oldSubnets, err := ReadSubnetsFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	added, removed, kept := DiffSubnets(oldSubnets, subnets)
+
+	// Наборы межсетевого экрана заменяются целиком, маршруты - по разнице
+	installed := subnets
+	var applyErr error
+	if replacer, ok := backend.(RouteReplacer); ok {
+		if err = replacer.Replace(subnets); err != nil {
+			return fmt.Errorf("ошибка замены набора подсетей (%s): %v", backend.Name(), err)
+		}
+	} else {
+		// Файл подсетей мог устареть: после перезагрузки, переподключения
+		// интерфейса или ip route flush маршрутов нет, а файл их перечисляет
+		current, err := backend.List()
+		if err != nil {
+			return fmt.Errorf("ошибка чтения установленных маршрутов (%s): %v", backend.Name(), err)
+		}
+		var missing []string
+		kept, missing = splitInstalled(kept, current)
+		if len(missing) > 0 {
+			fmt.Printf("Не найдено установленных ранее маршрутов: %d, они будут добавлены заново\n", len(missing))
+			added = append(added, missing...)
+		}
+
+		failedRemove, removeErr := RemoveRouteList(backend, removed)
+		failedAdd, addErr := AddRouteList(backend, added)
+		applyErr = errors.Join(removeErr, addErr)
+		if applyErr != nil {
+			notAdded := make(map[string]bool, len(failedAdd))
+			for _, subnet := range failedAdd {
+				notAdded[subnet] = true
+			}
+			installed = slices.DeleteFunc(slices.Clone(subnets), func(subnet string) bool {
+				return notAdded[subnet]
+			})
+			installed = append(installed, failedRemove...)
+		}
+	}
+
+	if err = UpdateSubnetsFile(installed, filePath); err != nil {
+		return errors.Join(applyErr, err)
+	}
+	if applyErr != nil {
+		return applyErr
+	}
+
+	fmt.Printf("Итого: добавлено %d, удалено %d, без изменений %d\n", len(added), len(removed), len(kept))
+	return nil
+}
+
+// splitInstalled делит подсети на те, маршруты которых есть в installed,
+// и те, маршрутов которых нет
+func splitInstalled(subnets, installed []string) (present, missing []string) {
+	installedSet := make(map[string]bool, len(installed))
+	for _, subnet := range installed {
+		installedSet[subnet] = true
+	}
+	for _, subnet := range subnets {
+		if installedSet[subnet] {
+			present = append(present, subnet)
+		} else {
+			missing = append(missing, subnet)
+		}
+	}
+	return present, missing
+}
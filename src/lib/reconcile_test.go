@@ -0,0 +1,171 @@
+package lib
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Тест для ReconcileRoutes: меняется только разница между наборами
+func TestReconcileRoutes(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "subnets.txt")
+	err := os.WriteFile(filePath, []byte("10.0.0.0/24\n10.0.1.0/24\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := NewRecordingBackend("10.0.0.0/24", "10.0.1.0/24")
+	err = ReconcileRoutes(backend, filePath, []string{"10.0.1.0/24", "10.0.2.0/24"})
+	if err != nil {
+		t.Fatalf("Ошибка ReconcileRoutes: %v", err)
+	}
+
+	expected := []RecordedCall{
+		{Op: "list"},
+		{Op: "del", Subnets: []string{"10.0.0.0/24"}},
+		{Op: "add", Subnets: []string{"10.0.2.0/24"}},
+	}
+	if !reflect.DeepEqual(backend.Calls, expected) {
+		t.Errorf("вызовы бэкенда = %v; ожидается %v", backend.Calls, expected)
+	}
+
+	saved, _ := ReadSubnetsFile(filePath)
+	if !reflect.DeepEqual(saved, []string{"10.0.1.0/24", "10.0.2.0/24"}) {
+		t.Errorf("файл подсетей = %v", saved)
+	}
+}
+
+// Тест для ReconcileRoutes после перезагрузки: маршрутов из файла подсетей
+// нет в системе, поэтому они добавляются заново
+func TestReconcileRoutesMissing(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "subnets.txt")
+	err := os.WriteFile(filePath, []byte("10.0.0.0/24\n10.0.1.0/24\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := NewRecordingBackend()
+	err = ReconcileRoutes(backend, filePath, []string{"10.0.0.0/24", "10.0.1.0/24"})
+	if err != nil {
+		t.Fatalf("Ошибка ReconcileRoutes: %v", err)
+	}
+
+	installed, _ := backend.List()
+	if !reflect.DeepEqual(installed, []string{"10.0.0.0/24", "10.0.1.0/24"}) {
+		t.Errorf("установленные маршруты = %v; ожидается [10.0.0.0/24 10.0.1.0/24]", installed)
+	}
+}
+
+// Тест для RemoveRoutes и последующего ReconcileRoutes: после удаления файл
+// подсетей пуст, и повторная установка добавляет все маршруты
+func TestRemoveRoutesThenReconcile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "subnets.txt")
+	subnets := []string{"10.0.0.0/24", "10.0.1.0/24"}
+
+	backend := NewRecordingBackend()
+	if err := ReconcileRoutes(backend, filePath, subnets); err != nil {
+		t.Fatalf("Ошибка ReconcileRoutes: %v", err)
+	}
+	if err := RemoveRoutes(backend, filePath); err != nil {
+		t.Fatalf("Ошибка RemoveRoutes: %v", err)
+	}
+	if saved, _ := ReadSubnetsFile(filePath); len(saved) != 0 {
+		t.Errorf("файл подсетей после удаления = %v; ожидается пустой", saved)
+	}
+	if installed, _ := backend.List(); len(installed) != 0 {
+		t.Errorf("установленные маршруты после удаления = %v", installed)
+	}
+
+	backend.Calls = nil
+	if err := ReconcileRoutes(backend, filePath, subnets); err != nil {
+		t.Fatalf("Ошибка ReconcileRoutes: %v", err)
+	}
+	expected := []RecordedCall{{Op: "list"}, {Op: "add", Subnets: subnets}}
+	if !reflect.DeepEqual(backend.Calls, expected) {
+		t.Errorf("вызовы бэкенда = %v; ожидается %v", backend.Calls, expected)
+	}
+}
+
+// Тест для ReconcileRoutes с ошибками бэкенда: в файл записываются только
+// фактически установленные маршруты, а функция возвращает ошибку
+func TestReconcileRoutesFailed(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "subnets.txt")
+	err := os.WriteFile(filePath, []byte("10.0.0.0/24\n10.0.1.0/24\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := NewRecordingBackend("10.0.0.0/24", "10.0.1.0/24")
+	backend.Errors = map[string]error{
+		"10.0.0.0/24": errors.New("удаление запрещено"),
+		"10.0.3.0/24": errors.New("нет маршрута до шлюза"),
+	}
+	err = ReconcileRoutes(backend, filePath, []string{"10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24"})
+	if err == nil {
+		t.Error("ReconcileRoutes() должна вернуть ошибку")
+	}
+
+	expected := []string{"10.0.1.0/24", "10.0.2.0/24", "10.0.0.0/24"}
+	saved, _ := ReadSubnetsFile(filePath)
+	if !reflect.DeepEqual(saved, expected) {
+		t.Errorf("файл подсетей = %v; ожидается %v", saved, expected)
+	}
+
+	// Следующее обновление повторяет неудавшиеся операции
+	backend.Errors = nil
+	if err = ReconcileRoutes(backend, filePath, []string{"10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24"}); err != nil {
+		t.Fatalf("Ошибка ReconcileRoutes: %v", err)
+	}
+	installed, _ := backend.List()
+	if !reflect.DeepEqual(installed, []string{"10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24"}) {
+		t.Errorf("установленные маршруты = %v", installed)
+	}
+}
+
+// Тест для ReconcileRoutes при первом запуске без файла подсетей
+func TestReconcileRoutesFirstRun(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "subnets.txt")
+
+	backend := NewRecordingBackend()
+	err := ReconcileRoutes(backend, filePath, []string{"10.0.0.0/24"})
+	if err != nil {
+		t.Fatalf("Ошибка ReconcileRoutes: %v", err)
+	}
+
+	installed, _ := backend.List()
+	if !reflect.DeepEqual(installed, []string{"10.0.0.0/24"}) {
+		t.Errorf("установленные маршруты = %v; ожидается [10.0.0.0/24]", installed)
+	}
+}
+
+// replacingBackend - фейковый бэкенд наборов, который заменяет подсети целиком
+type replacingBackend struct {
+	*RecordingBackend
+}
+
+func (b replacingBackend) Replace(subnets []string) error {
+	b.Calls = append(b.Calls, RecordedCall{Op: "replace", Subnets: subnets})
+	return nil
+}
+
+// Тест для ReconcileRoutes с бэкендом, заменяющим набор целиком
+func TestReconcileRoutesReplace(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "subnets.txt")
+	err := os.WriteFile(filePath, []byte("10.0.0.0/24\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := replacingBackend{NewRecordingBackend("10.0.0.0/24")}
+	err = ReconcileRoutes(backend, filePath, []string{"10.0.1.0/24"})
+	if err != nil {
+		t.Fatalf("Ошибка ReconcileRoutes: %v", err)
+	}
+
+	expected := []RecordedCall{{Op: "replace", Subnets: []string{"10.0.1.0/24"}}}
+	if !reflect.DeepEqual(backend.Calls, expected) {
+		t.Errorf("вызовы бэкенда = %v; ожидается %v", backend.Calls, expected)
+	}
+}
@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 2 * time.Minute}
+
+// RIPEResponse - тело ответа RIPEstat и сведения о его происхождении
+type RIPEResponse struct {
+	URL       string
+	Body      []byte
+	QueryTime string
+	FetchedAt time.Time
+	// Stale - загрузка не удалась и использован ответ из кэша,
+	// FetchErr - ошибка этой загрузки
+	Stale    bool
+	FetchErr error
+}
+
+// FetchRIPEstat загружает ответ RIPEstat. Если загрузка не удалась,
+// возвращается сохраненный ответ не старше cache.MaxAge с признаком Stale.
+// Свежий ответ попадает в кэш только через Save после проверки данных.
+func FetchRIPEstat(url string, cache *Cache) (*RIPEResponse, error) {
+	return fetchCached(url, cache, fetchRIPEstat)
+}
+
+// FetchSource загружает файл источника данных: по URL через кэш, как
+// FetchRIPEstat, или с локального диска, если location - не http(s) адрес
+func FetchSource(location string, cache *Cache) (*RIPEResponse, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		body, err := os.ReadFile(location)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения файла: %v", err)
+		}
+		return &RIPEResponse{Body: body, FetchedAt: time.Now()}, nil
+	}
+	return fetchCached(location, cache, fetchURL)
+}
+
+// Save сохраняет свежий ответ в кэш. Вызывается после проверки данных,
+// чтобы пустой или обрезанный ответ не заменил последнюю хорошую копию.
+// Ответы из кэша и локальные файлы не сохраняются.
+func (r *RIPEResponse) Save(cache *Cache) error {
+	if cache == nil || r.Stale || r.URL == "" {
+		return nil
+	}
+	return cache.Save(r.URL, r.Body, r.QueryTime)
+}
+
+// fetchCached загружает url функцией fetch, а при ошибке возвращает ответ
+// из кэша с признаком Stale и ошибкой загрузки. Предупреждение о данных из
+// кэша выводит вызывающий.
+func fetchCached(url string, cache *Cache, fetch func(url string) ([]byte, string, error)) (*RIPEResponse, error) {
+	body, queryTime, err := fetch(url)
+	if err == nil {
+		return &RIPEResponse{URL: url, Body: body, QueryTime: queryTime, FetchedAt: time.Now()}, nil
+	}
+	if cache == nil {
+		return nil, err
+	}
+
+	cached, cacheErr := cache.Load(url)
+	if cacheErr != nil {
+		return nil, fmt.Errorf("%v; %v", err, cacheErr)
+	}
+	return &RIPEResponse{
+		URL:       url,
+		Body:      cached.Body,
+		QueryTime: cached.QueryTime,
+		FetchedAt: cached.FetchedAt,
+		Stale:     true,
+		FetchErr:  err,
+	}, nil
+}
+
+// fetchRIPEstat выполняет запрос и проверяет, что ответ - корректный JSON RIPEstat
+func fetchRIPEstat(url string) ([]byte, string, error) {
+	body, _, err := fetchURL(url)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var envelope struct {
+		Status string `json:"status"`
+		Data   struct {
+			QueryTime string `json:"query_time"`
+		} `json:"data"`
+	}
+	if err = json.Unmarshal(body, &envelope); err != nil {
+		return nil, "", fmt.Errorf("ошибка разбора JSON: %v", err)
+	}
+	if envelope.Status != "" && envelope.Status != "ok" {
+		return nil, "", fmt.Errorf("RIPEstat вернул статус %s", envelope.Status)
+	}
+
+	return body, envelope.Data.QueryTime, nil
+}
+
+// fetchURL выполняет запрос и возвращает тело ответа
+func fetchURL(url string) ([]byte, string, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, "", fmt.Errorf("ошибка загрузки данных: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("ошибка чтения ответа: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("ошибка загрузки данных: HTTP %s", resp.Status)
+	}
+	return body, "", nil
+}
@@ -0,0 +1,81 @@
+package lib
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Тест для FetchRIPEstat: при недоступности сервера используется кэш
+func TestFetchRIPEstatCacheFallback(t *testing.T) {
+	available := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"ok","data":{"query_time":"2024-01-01T00:00:00","resources":{"ipv4":["10.0.0.0/8"]}}}`))
+	}))
+	defer server.Close()
+
+	cache := &Cache{Dir: t.TempDir(), MaxAge: time.Hour}
+
+	resp, err := FetchRIPEstat(server.URL, cache)
+	if err != nil || resp.Stale {
+		t.Fatalf("FetchRIPEstat() = %v, %v; ожидается свежий ответ", resp, err)
+	}
+	if err = resp.Save(cache); err != nil {
+		t.Fatalf("Ошибка Save: %v", err)
+	}
+
+	available = false
+	resp, err = FetchRIPEstat(server.URL, cache)
+	if err != nil {
+		t.Fatalf("Ошибка FetchRIPEstat с кэшем: %v", err)
+	}
+	if !resp.Stale || resp.FetchErr == nil || resp.QueryTime != "2024-01-01T00:00:00" {
+		t.Errorf("FetchRIPEstat() = %+v; ожидается ответ из кэша с ошибкой загрузки", resp)
+	}
+
+	cache.MaxAge = 0
+	if _, err = FetchRIPEstat(server.URL, cache); err == nil {
+		t.Error("FetchRIPEstat() должна вернуть ошибку при устаревшем кэше")
+	}
+}
+
+// Тест для FetchRIPEstat: свежий ответ не попадает в кэш до Save, поэтому
+// непроверенный ответ не заменяет последнюю хорошую копию
+func TestFetchRIPEstatSaveAfterValidation(t *testing.T) {
+	body := `{"status":"ok","data":{"query_time":"2024-01-01T00:00:00","resources":{"ipv4":["10.0.0.0/8"]}}}`
+	available := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	cache := &Cache{Dir: t.TempDir(), MaxAge: time.Hour}
+	resp, err := FetchRIPEstat(server.URL, cache)
+	if err != nil {
+		t.Fatalf("Ошибка FetchRIPEstat: %v", err)
+	}
+	if err = resp.Save(cache); err != nil {
+		t.Fatalf("Ошибка Save: %v", err)
+	}
+
+	// Пустой ответ загружен, но не сохранен: в кэше остается прежний
+	good := body
+	body = `{"status":"ok","data":{"query_time":"2024-01-02T00:00:00","resources":{"ipv4":[]}}}`
+	if _, err = FetchRIPEstat(server.URL, cache); err != nil {
+		t.Fatalf("Ошибка FetchRIPEstat: %v", err)
+	}
+	available = false
+	resp, err = FetchRIPEstat(server.URL, cache)
+	if err != nil || !resp.Stale || string(resp.Body) != good {
+		t.Errorf("FetchRIPEstat() = %s, %v; ожидается прежний ответ из кэша", resp.Body, err)
+	}
+}
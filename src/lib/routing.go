@@ -2,14 +2,246 @@ package lib
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"net/netip"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 )
 
-// Функция для удаления маршрутов
-func RemoveRoutes(filePath, iface string) error {
+// RouteResult - результат операции с маршрутом для одной подсети
+type RouteResult struct {
+	Subnet string
+	Err    error
+}
+
+// RouteBackend - способ установки маршрутов в систему.
+// Add и Delete возвращают результат по каждой подсети, а ошибку - только
+// если бэкенд не смог выполнить операцию целиком.
+type RouteBackend interface {
+	// Name возвращает имя бэкенда для вывода
+	Name() string
+	// Add добавляет маршруты для подсетей
+	Add(subnets []string) ([]RouteResult, error)
+	// Delete удаляет маршруты для подсетей
+	Delete(subnets []string) ([]RouteResult, error)
+	// List возвращает подсети, маршруты для которых установлены бэкендом
+	List() ([]string, error)
+	// Flush удаляет все маршруты, которые возвращает List
+	Flush() error
+}
+
+// RouteOptions - параметры устанавливаемых маршрутов. Одни и те же
+// параметры используются при добавлении, удалении и поиске маршрутов.
+type RouteOptions struct {
+	Interface   string
+	InterfaceV6 string
+	Gateway     string
+	GatewayV6   string
+	// Metric - метрика маршрута, 0 - по умолчанию
+	Metric int
+	// Table - номер таблицы маршрутизации, по умолчанию main (254)
+	Table int
+	// Protocol - номер протокола, которым помечаются маршруты, по умолчанию boot (3)
+	Protocol int
+	// Type - тип маршрута: unicast, blackhole, unreachable или prohibit
+	Type string
+	// SetName - имя набора ipset или nftables для IPv4, IPv6 набор
+	// получает суффикс _v6
+	SetName string
+	// NftTable - таблица nftables с набором в виде "семейство имя"
+	NftTable string
+	// RciURL - адрес RCI API роутера Keenetic
+	RciURL string
+	// Comment - комментарий, которым помечаются маршруты в конфигурации Keenetic
+	Comment string
+}
+
+// RouteReplacer - бэкенд, который умеет атомарно заменить весь набор подсетей.
+// ReconcileRoutes использует Replace вместо удаления и добавления разницы.
+type RouteReplacer interface {
+	Replace(subnets []string) error
+}
+
+// Именованные таблицы и протоколы из /etc/iproute2
+var (
+	routeTables = map[string]int{"main": 254, "local": 255, "default": 253}
+	routeProtos = map[string]int{"boot": 3, "static": 4, "ra": 9, "zebra": 11, "bird": 12, "dhcp": 16}
+	routeTypes  = []string{"unicast", "blackhole", "unreachable", "prohibit"}
+)
+
+// routeTablesFiles - файлы имен таблиц iproute2. Новые версии iproute2
+// хранят стандартный файл в /usr/share, а /etc его дополняет.
+var routeTablesFiles = []string{"/usr/share/iproute2/rt_tables", "/etc/iproute2/rt_tables", "/etc/iproute2/rt_tables.d/*.conf"}
+
+// routeTableNames возвращает имена таблиц: стандартные и из routeTablesFiles.
+// ip rule show выводит таблицы по этим именам, например "lookup vpn".
+func routeTableNames() map[string]int {
+	names := maps.Clone(routeTables)
+	for _, pattern := range routeTablesFiles {
+		paths, _ := filepath.Glob(pattern)
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			parseRouteTablesFile(string(data), names)
+		}
+	}
+	return names
+}
+
+// parseRouteTablesFile добавляет в names таблицы из файла rt_tables:
+// строки "номер имя", текст после # - комментарий
+func parseRouteTablesFile(data string, names map[string]int) {
+	for _, line := range strings.Split(data, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[0], 0, 32)
+		if err != nil {
+			continue
+		}
+		names[fields[1]] = int(n)
+	}
+}
+
+// parseRouteTable разбирает таблицу маршрутизации: номер или имя
+func parseRouteTable(value string) (int, error) {
+	if value == "" {
+		return routeTables["main"], nil
+	}
+	return parseRouteNumber(value, routeTableNames(), 1, math.MaxInt32, "таблица маршрутизации")
+}
+
+// parseRouteProto разбирает протокол маршрутов: номер или имя
+func parseRouteProto(value string) (int, error) {
+	if value == "" {
+		return routeProtos["boot"], nil
+	}
+	return parseRouteNumber(value, routeProtos, 1, 255, "протокол маршрутов")
+}
+
+// parseRouteType проверяет тип маршрута
+func parseRouteType(value string) (string, error) {
+	if value == "" {
+		return "unicast", nil
+	}
+	if !slices.Contains(routeTypes, value) {
+		return "", fmt.Errorf("неизвестный тип маршрута %s", value)
+	}
+	return value, nil
+}
+
+func parseRouteNumber(value string, names map[string]int, minValue, maxValue int, what string) (int, error) {
+	if n, ok := names[value]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < minValue || n > maxValue {
+		return 0, fmt.Errorf("некорректное значение: %s %s", what, value)
+	}
+	return n, nil
+}
+
+// iface возвращает интерфейс для семейства адресов. Если InterfaceV6
+// не задан, IPv6 маршруты устанавливаются на основной интерфейс.
+func (o RouteOptions) iface(v6 bool) string {
+	if v6 && o.InterfaceV6 != "" {
+		return o.InterfaceV6
+	}
+	return o.Interface
+}
+
+// gateway возвращает шлюз для семейства адресов
+func (o RouteOptions) gateway(v6 bool) string {
+	if v6 {
+		return o.GatewayV6
+	}
+	return o.Gateway
+}
+
+// unicast сообщает, что маршруты ведут через интерфейс или шлюз,
+// а не отбрасывают трафик
+func (o RouteOptions) unicast() bool {
+	return o.Type == "" || o.Type == "unicast"
+}
+
+// configured сообщает, можно ли устанавливать маршруты семейства адресов:
+// для blackhole и подобных достаточно типа, для unicast нужен интерфейс или шлюз
+func (o RouteOptions) configured(v6 bool) bool {
+	return !o.unicast() || o.iface(v6) != "" || o.gateway(v6) != ""
+}
+
+// table возвращает таблицу маршрутизации, main, если она не задана
+func (o RouteOptions) table() int {
+	if o.Table == 0 {
+		return routeTables["main"]
+	}
+	return o.Table
+}
+
+// setName возвращает имя набора для семейства адресов
+func (o RouteOptions) setName(v6 bool) string {
+	if v6 {
+		return o.SetName + "_v6"
+	}
+	return o.SetName
+}
+
+// SetBackend сообщает, что бэкенд заполняет наборы межсетевого экрана,
+// а не таблицу маршрутов, и интерфейс или шлюз ему не нужны
+func SetBackend(kind string) bool {
+	return kind == "ipset" || kind == "nftables"
+}
+
+// protocol возвращает протокол маршрутов, boot, если он не задан
+func (o RouteOptions) protocol() int {
+	if o.Protocol == 0 {
+		return routeProtos["boot"]
+	}
+	return o.Protocol
+}
+
+// NewRouteBackend создает бэкенд маршрутов по ключу backend из конфигурации
+func NewRouteBackend(kind string, options RouteOptions) (RouteBackend, error) {
+	switch kind {
+	case "", "auto":
+		if netlinkAvailable() {
+			return &NetlinkBackend{RouteOptions: options}, nil
+		}
+		return &IPBackend{RouteOptions: options}, nil
+	case "netlink":
+		return &NetlinkBackend{RouteOptions: options}, nil
+	case "ip":
+		return &IPBackend{RouteOptions: options}, nil
+	case "ipset":
+		if len(options.setName(true)+ipsetTmpSuffix) > ipsetMaxName {
+			return nil, fmt.Errorf("имя набора ipset %s длиннее %d символов", options.SetName, ipsetMaxName-len("_v6"+ipsetTmpSuffix))
+		}
+		return &IPSetBackend{RouteOptions: options}, nil
+	case "nftables":
+		if _, _, err := options.nftTable(); err != nil {
+			return nil, err
+		}
+		return &NftBackend{RouteOptions: options}, nil
+	case "keenetic":
+		return &KeeneticBackend{RouteOptions: options}, nil
+	default:
+		return nil, fmt.Errorf("неизвестный бэкенд маршрутов: %s", kind)
+	}
+}
+
+// Функция для удаления маршрутов. В файле подсетей остаются только
+// подсети, маршруты которых удалить не удалось.
+func RemoveRoutes(backend RouteBackend, filePath string) error {
 	// Открываем предыдущий файл
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -17,49 +249,160 @@ func RemoveRoutes(filePath, iface string) error {
 	}
 	defer file.Close()
 
-	// Читаем файл построчно
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		subnet := strings.TrimSpace(scanner.Text())
-		if !strings.Contains(subnet, "/") {
-			continue
-		}
-
-		// Удаляем маршрут
-		cmd := exec.Command("ip", "route", "del", subnet, "dev", iface)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			fmt.Printf("Ошибка удаления маршрута %s: %s\n", subnet, string(output))
-		} else {
-			fmt.Printf("Маршрут для подсети %s удален\n", subnet)
-		}
+	subnets, err := scanSubnets(file)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	failed, removeErr := RemoveRouteList(backend, subnets)
+	if err = UpdateSubnetsFile(failed, filePath); err != nil {
+		return errors.Join(removeErr, err)
+	}
+	return removeErr
 }
 
 // Функция для добавления маршрута
-func AddRoutes(filePath, iface string) error {
+func AddRoutes(backend RouteBackend, filePath string) error {
 	// Открываем файл
 	file, err := os.Open(filePath)
 	if err != nil {
 		return fmt.Errorf("ошибка открытия файла для добавления маршрутов: %v", err)
 	}
 	defer file.Close()
-	// Читаем файл построчно
+
+	subnets, err := scanSubnets(file)
+	if err != nil {
+		return err
+	}
+	_, err = AddRouteList(backend, subnets)
+	return err
+}
+
+// RemoveRouteList удаляет маршруты для переданного списка подсетей и
+// возвращает подсети, маршруты которых удалить не удалось
+func RemoveRouteList(backend RouteBackend, subnets []string) ([]string, error) {
+	if len(subnets) == 0 {
+		return nil, nil
+	}
+	results, err := backend.Delete(subnets)
+	if err != nil {
+		return subnets, fmt.Errorf("ошибка удаления маршрутов (%s): %v", backend.Name(), err)
+	}
+	var failed []string
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("Ошибка удаления маршрута %s: %v\n", result.Subnet, result.Err)
+			failed = append(failed, result.Subnet)
+		} else {
+			fmt.Printf("Маршрут для подсети %s удален\n", result.Subnet)
+		}
+	}
+	if len(failed) > 0 {
+		return failed, fmt.Errorf("не удалось удалить маршрутов: %d (%s)", len(failed), backend.Name())
+	}
+	return nil, nil
+}
+
+// AddRouteList добавляет маршруты для переданного списка подсетей и
+// возвращает подсети, маршруты которых добавить не удалось
+func AddRouteList(backend RouteBackend, subnets []string) ([]string, error) {
+	if len(subnets) == 0 {
+		return nil, nil
+	}
+	results, err := backend.Add(subnets)
+	if err != nil {
+		return subnets, fmt.Errorf("ошибка добавления маршрутов (%s): %v", backend.Name(), err)
+	}
+	var failed []string
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("Ошибка добавления маршрута %s: %v\n", result.Subnet, result.Err)
+			failed = append(failed, result.Subnet)
+		} else {
+			fmt.Printf("Маршрут для подсети %s добавлен\n", result.Subnet)
+		}
+	}
+	if len(failed) > 0 {
+		return failed, fmt.Errorf("не удалось добавить маршрутов: %d (%s)", len(failed), backend.Name())
+	}
+	return nil, nil
+}
+
+// scanSubnets читает подсети построчно, пропуская строки без префикса
+func scanSubnets(file *os.File) ([]string, error) {
+	var subnets []string
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		subnet := strings.TrimSpace(scanner.Text())
 		if !strings.Contains(subnet, "/") {
 			continue
 		}
-		cmd := exec.Command("ip", "route", "add", subnet, "dev", iface)
-		output, err := cmd.CombinedOutput()
+		subnets = append(subnets, subnet)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла %s: %v", file.Name(), err)
+	}
+	return subnets, nil
+}
+
+// runByFamily выполняет операцию отдельно для IPv4 и IPv6 подсетей,
+// так как они могут устанавливаться на разные интерфейсы
+func runByFamily(subnets []string, fn func(subnets []string, v6 bool) ([]RouteResult, error)) ([]RouteResult, error) {
+	v4, v6 := splitByFamily(subnets)
+
+	var results []RouteResult
+	for _, group := range []struct {
+		subnets []string
+		v6      bool
+	}{{v4, false}, {v6, true}} {
+		if len(group.subnets) == 0 {
+			continue
+		}
+		groupResults, err := fn(group.subnets, group.v6)
 		if err != nil {
-			fmt.Printf("Ошибка добавления маршрута %s: %s\n", subnet, string(output))
+			return nil, err
+		}
+		results = append(results, groupResults...)
+	}
+	return results, nil
+}
+
+// splitByFamily делит подсети на IPv4 и IPv6
+func splitByFamily(subnets []string) (v4, v6 []string) {
+	for _, subnet := range subnets {
+		if strings.Contains(subnet, ":") {
+			v6 = append(v6, subnet)
 		} else {
-			fmt.Printf("Маршрут для подсети %s добавлен\n", subnet)
+			v4 = append(v4, subnet)
+		}
+	}
+	return v4, v6
+}
+
+// checkSubnets заранее проверяет подсети, которые передаются внешней
+// программе одним пакетом: некорректная строка прервала бы весь пакет.
+// Возвращает результаты с ошибками разбора и список корректных подсетей.
+func checkSubnets(subnets []string) ([]RouteResult, []string) {
+	results := make([]RouteResult, len(subnets))
+	var valid []string
+	for i, subnet := range subnets {
+		results[i].Subnet = subnet
+		if _, err := netip.ParsePrefix(subnet); err != nil {
+			results[i].Err = fmt.Errorf("ошибка разбора подсети: %v", err)
+			continue
 		}
+		valid = append(valid, subnet)
+	}
+	return results, valid
+}
+
+// hostPrefix дополняет адрес хоста длиной префикса
+func hostPrefix(subnet string) string {
+	if strings.Contains(subnet, "/") {
+		return subnet
+	}
+	if strings.Contains(subnet, ":") {
+		return subnet + "/128"
 	}
-	return nil
+	return subnet + "/32"
 }
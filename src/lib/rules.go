@@ -0,0 +1,299 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Приоритет правил по умолчанию: после local (0), но до main (32766)
+const DefaultRulePriority = 1000
+
+// Policy - правило ip rule профиля. Трафик, подходящий под условия,
+// ищет маршрут в таблице профиля; без условий правило действует на весь трафик.
+type Policy struct {
+	Priority int    `json:"priority"`
+	From     string `json:"from"`
+	FwMark   string `json:"fwmark"`
+	IIF      string `json:"iif"`
+}
+
+// Rule - правило policy routing в том виде, в каком его показывает `ip rule`
+type Rule struct {
+	Priority int
+	// From - адреса источника, нулевой префикс - все адреса
+	From netip.Prefix
+	// Mark и Mask - метка пакета, Mask == 0 - метка не проверяется
+	Mark uint32
+	Mask uint32
+	IIF  string
+	// Table - таблица, в которой ищется маршрут
+	Table int
+	V6    bool
+	// foreign - у правила есть условия, которыми мы не управляем
+	foreign bool
+}
+
+// String возвращает правило в виде условий `ip rule`
+func (r Rule) String() string {
+	if r.V6 {
+		return strings.Join(r.args(), " ") + " (IPv6)"
+	}
+	return strings.Join(r.args(), " ")
+}
+
+// args возвращает аргументы ip rule add/del для правила
+func (r Rule) args() []string {
+	args := []string{"pref", strconv.Itoa(r.Priority)}
+	if r.From.IsValid() {
+		args = append(args, "from", r.From.String())
+	}
+	if r.Mask != 0 {
+		args = append(args, "fwmark", formatFwMark(r.Mark, r.Mask))
+	}
+	if r.IIF != "" {
+		args = append(args, "iif", r.IIF)
+	}
+	return append(args, "lookup", strconv.Itoa(r.Table))
+}
+
+// PolicyRules возвращает правила ip rule профиля, по одному на семейство
+// адресов. Если policy не задан, правил нет и маршруты ставятся как обычно.
+func (p *Profile) PolicyRules() ([]Rule, error) {
+	if p.Policy == nil {
+		return nil, nil
+	}
+	options, err := p.RouteOptions()
+	if err != nil {
+		return nil, err
+	}
+	for name, table := range routeTables {
+		if options.table() == table {
+			return nil, fmt.Errorf("для policy нужна отдельная таблица, а не %s", name)
+		}
+	}
+
+	rule := Rule{Priority: p.Policy.Priority, IIF: p.Policy.IIF, Table: options.table()}
+	if rule.Priority == 0 {
+		rule.Priority = DefaultRulePriority
+	}
+	if rule.Priority < 1 || rule.Priority >= 32766 {
+		return nil, fmt.Errorf("некорректный приоритет правила %d", rule.Priority)
+	}
+	if p.Policy.FwMark != "" {
+		if rule.Mark, rule.Mask, err = parseFwMark(p.Policy.FwMark); err != nil {
+			return nil, err
+		}
+	}
+
+	families := []bool{false}
+	if p.IPv6 {
+		families = append(families, true)
+	}
+	if p.Policy.From != "" {
+		if rule.From, err = parseRulePrefix(p.Policy.From); err != nil {
+			return nil, fmt.Errorf("некорректный адрес источника %s", p.Policy.From)
+		}
+		families = []bool{rule.From.Addr().Is6()}
+	}
+
+	var rules []Rule
+	for _, v6 := range families {
+		rule.V6 = v6
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// EnsureRules устанавливает правила, которых еще нет, и удаляет устаревшие
+// правила с тем же приоритетом и таблицей, оставшиеся от прежних настроек.
+// После изменений правила проверяются повторным чтением.
+func EnsureRules(rules []Rule) error {
+	for _, rule := range rules {
+		installed, err := ListRules(rule.V6)
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, other := range installed {
+			switch {
+			case other == rule:
+				found = true
+			case other.Priority == rule.Priority && other.Table == rule.Table && !other.foreign:
+				if err = runRule("del", other); err != nil {
+					return err
+				}
+				fmt.Printf("Устаревшее правило %s удалено\n", other)
+			}
+		}
+		if found {
+			fmt.Printf("Правило %s уже установлено\n", rule)
+			continue
+		}
+
+		if err = runRule("add", rule); err != nil {
+			return err
+		}
+		if ok, err := RuleInstalled(rule); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("правило %s не появилось после добавления", rule)
+		}
+		fmt.Printf("Правило %s добавлено\n", rule)
+	}
+	return nil
+}
+
+// RemoveRules удаляет правила профиля, в том числе оставшиеся от прежних
+// настроек правила с тем же приоритетом и таблицей. Отсутствие правил не ошибка.
+func RemoveRules(rules []Rule) error {
+	for _, rule := range rules {
+		installed, err := ListRules(rule.V6)
+		if err != nil {
+			return err
+		}
+		for _, other := range installed {
+			if other.Priority != rule.Priority || other.Table != rule.Table || other.foreign {
+				continue
+			}
+			if err = runRule("del", other); err != nil {
+				return err
+			}
+			fmt.Printf("Правило %s удалено\n", other)
+		}
+	}
+	return nil
+}
+
+// ListRules возвращает правила policy routing семейства адресов
+func ListRules(v6 bool) ([]Rule, error) {
+	output, err := exec.Command("ip", familyFlag(v6), "rule", "show").Output()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения правил маршрутизации: %v", err)
+	}
+	return parseRuleList(string(output), v6), nil
+}
+
+// RuleInstalled проверяет, что правило установлено
+func RuleInstalled(rule Rule) (bool, error) {
+	installed, err := ListRules(rule.V6)
+	if err != nil {
+		return false, err
+	}
+	for _, other := range installed {
+		if other == rule {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// runRule выполняет ip rule add или del для правила
+func runRule(action string, rule Rule) error {
+	args := append([]string{familyFlag(rule.V6), "rule", action}, rule.args()...)
+	output, err := exec.Command("ip", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ошибка ip rule %s %s: %s", action, rule, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// parseRuleList разбирает вывод `ip rule show`, например
+// "1000:	from 192.168.1.0/24 fwmark 0x1/0xff iif br0 lookup 100".
+// Правила с неизвестными условиями помечаются как чужие.
+func parseRuleList(output string, v6 bool) []Rule {
+	tables := routeTableNames()
+	var rules []Rule
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasSuffix(fields[0], ":") {
+			continue
+		}
+		priority, err := strconv.Atoi(strings.TrimSuffix(fields[0], ":"))
+		if err != nil {
+			continue
+		}
+
+		rule := Rule{Priority: priority, V6: v6, Table: -1}
+		for i := 1; i < len(fields); i++ {
+			key := fields[i]
+			if key == "[detached]" {
+				continue
+			}
+			if i+1 >= len(fields) {
+				rule.foreign = true
+				break
+			}
+			value := fields[i+1]
+			i++
+			switch key {
+			case "from":
+				if value != "all" {
+					if rule.From, err = parseRulePrefix(value); err != nil {
+						rule.foreign = true
+					}
+				}
+			case "fwmark":
+				if rule.Mark, rule.Mask, err = parseFwMark(value); err != nil {
+					rule.foreign = true
+				}
+			case "iif":
+				rule.IIF = value
+			case "lookup", "table":
+				if rule.Table, err = parseRouteNumber(value, tables, 0, math.MaxInt32, "таблица"); err != nil {
+					rule.foreign = true
+				}
+			default:
+				rule.foreign = true
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// parseRulePrefix разбирает адрес или подсеть источника. Адрес хоста
+// дополняется длиной префикса, как это делает ip.
+func parseRulePrefix(value string) (netip.Prefix, error) {
+	if !strings.Contains(value, "/") {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
+// parseFwMark разбирает метку вида "1", "0x1" или "0x1/0xff"
+func parseFwMark(value string) (mark, mask uint32, err error) {
+	markValue, maskValue, hasMask := strings.Cut(value, "/")
+	parsedMark, err := strconv.ParseUint(markValue, 0, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("некорректная метка fwmark %s", value)
+	}
+	parsedMask := uint64(0xffffffff)
+	if hasMask {
+		parsedMask, err = strconv.ParseUint(maskValue, 0, 32)
+		if err != nil || parsedMask == 0 {
+			return 0, 0, fmt.Errorf("некорректная маска fwmark %s", value)
+		}
+	}
+	return uint32(parsedMark), uint32(parsedMask), nil
+}
+
+// formatFwMark записывает метку так же, как ее показывает ip rule
+func formatFwMark(mark, mask uint32) string {
+	if mask == 0xffffffff {
+		return fmt.Sprintf("0x%x", mark)
+	}
+	return fmt.Sprintf("0x%x/0x%x", mark, mask)
+}
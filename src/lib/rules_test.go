@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Тест для parseRuleList
+func TestParseRuleList(t *testing.T) {
+	output := "0:\tfrom all lookup local\n" +
+		"1000:\tfrom 192.168.1.0/24 fwmark 0x1/0xff iif br0 lookup 100\n" +
+		"1100:\tfrom 192.168.1.10 lookup 100\n" +
+		"1200:\tfrom all to 10.0.0.0/8 lookup 100\n" +
+		"32766:\tfrom all lookup main\n"
+
+	expected := []Rule{
+		{Priority: 0, Table: 255},
+		{Priority: 1000, From: netip.MustParsePrefix("192.168.1.0/24"), Mark: 1, Mask: 0xff, IIF: "br0", Table: 100},
+		{Priority: 1100, From: netip.MustParsePrefix("192.168.1.10/32"), Table: 100},
+		{Priority: 1200, Table: 100, foreign: true},
+		{Priority: 32766, Table: 254},
+	}
+	if result := parseRuleList(output, false); !reflect.DeepEqual(result, expected) {
+		t.Errorf("parseRuleList() = %v; ожидается %v", result, expected)
+	}
+}
+
+// Тест для parseRuleList с именами таблиц из rt_tables: собственное правило
+// с "lookup vpn" не считается чужим
+func TestParseRuleListTableNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rt_tables")
+	data := "255\tlocal\n254\tmain\n# vpn\n100\tvpn\n0x65 lan # офис\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	saved := routeTablesFiles
+	routeTablesFiles = []string{path}
+	defer func() { routeTablesFiles = saved }()
+
+	output := "1000:\tfwmark 0x1 lookup vpn\n1100:\tfrom all lookup lan\n1200:\tfrom all lookup unknown\n"
+	expected := []Rule{
+		{Priority: 1000, Mark: 1, Mask: 0xffffffff, Table: 100},
+		{Priority: 1100, Table: 101},
+		{Priority: 1200, Table: 0, foreign: true},
+	}
+	if result := parseRuleList(output, false); !reflect.DeepEqual(result, expected) {
+		t.Errorf("parseRuleList() = %v; ожидается %v", result, expected)
+	}
+
+	profile := &Profile{Table: "vpn"}
+	if options, err := profile.RouteOptions(); err != nil || options.Table != 100 {
+		t.Errorf("RouteOptions(table vpn) = %+v, %v; ожидается таблица 100", options, err)
+	}
+}
+
+// Тест для parseFwMark и formatFwMark
+func TestParseFwMark(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+		valid    bool
+	}{
+		{"1", "0x1", true},
+		{"0x10", "0x10", true},
+		{"0x1/0xff", "0x1/0xff", true},
+		{"0x1/0", "", false},
+		{"mark", "", false},
+	}
+
+	for _, test := range tests {
+		mark, mask, err := parseFwMark(test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("parseFwMark(%s): ошибка %v; ожидается корректность %v", test.value, err, test.valid)
+			continue
+		}
+		if err == nil && formatFwMark(mark, mask) != test.expected {
+			t.Errorf("parseFwMark(%s) = %s; ожидается %s", test.value, formatFwMark(mark, mask), test.expected)
+		}
+	}
+}
+
+// Тест для Profile.PolicyRules
+func TestPolicyRules(t *testing.T) {
+	tests := []struct {
+		profile  Profile
+		expected []string
+		valid    bool
+	}{
+		{Profile{Table: "100"}, nil, true},
+		{Profile{Table: "100", IPv6: true, Policy: &Policy{}},
+			[]string{"pref 1000 lookup 100", "pref 1000 lookup 100 (IPv6)"}, true},
+		{Profile{Table: "100", IPv6: true, Policy: &Policy{Priority: 500, From: "192.168.1.10", IIF: "br0"}},
+			[]string{"pref 500 from 192.168.1.10/32 iif br0 lookup 100"}, true},
+		{Profile{Table: "100", Policy: &Policy{FwMark: "0x2/0x3"}},
+			[]string{"pref 1000 fwmark 0x2/0x3 lookup 100"}, true},
+		{Profile{Policy: &Policy{}}, nil, false},
+		{Profile{Table: "main", Policy: &Policy{}}, nil, false},
+		{Profile{Table: "100", Policy: &Policy{Priority: 32766}}, nil, false},
+		{Profile{Table: "100", Policy: &Policy{From: "lan"}}, nil, false},
+	}
+
+	for _, test := range tests {
+		rules, err := test.profile.PolicyRules()
+		if (err == nil) != test.valid {
+			t.Errorf("PolicyRules(%s): ошибка %v; ожидается корректность %v", test.profile.Table, err, test.valid)
+			continue
+		}
+		var result []string
+		for _, rule := range rules {
+			result = append(result, rule.String())
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("PolicyRules(%s) = %v; ожидается %v", test.profile.Table, result, test.expected)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package lib
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Значения расписания режима демона по умолчанию
+const (
+	DefaultRefreshInterval = 24 * time.Hour
+	DefaultRefreshJitter   = time.Hour
+	DefaultRetryMin        = time.Minute
+	DefaultRetryMax        = time.Hour
+)
+
+// Schedule - расписание обновлений в режиме демона
+type Schedule struct {
+	// Interval - период обновления при успешном запуске
+	Interval time.Duration
+	// Jitter - случайная добавка к периоду, чтобы роутеры не обращались
+	// к RIPEstat одновременно
+	Jitter time.Duration
+	// RetryMin и RetryMax - первая и наибольшая задержки повтора, если
+	// данные RIPE не удалось получить; задержка удваивается с каждой неудачей
+	RetryMin time.Duration
+	RetryMax time.Duration
+}
+
+// Next возвращает задержку до следующего обновления после failures
+// неудачных запусков подряд
+func (s *Schedule) Next(failures int) time.Duration {
+	if failures == 0 {
+		delay := s.Interval
+		if s.Jitter > 0 {
+			delay += rand.N(s.Jitter)
+		}
+		return delay
+	}
+
+	delay := s.RetryMin
+	for i := 1; i < failures && delay < s.RetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, s.RetryMax)
+}
@@ -0,0 +1,51 @@
+package lib
+
+import (
+	"testing"
+	"time"
+)
+
+// Тест для Schedule.Next: период с добавкой и удвоение задержки при неудачах
+func TestScheduleNext(t *testing.T) {
+	schedule := &Schedule{Interval: time.Hour, Jitter: 10 * time.Minute, RetryMin: time.Minute, RetryMax: 5 * time.Minute}
+
+	for i := 0; i < 100; i++ {
+		if delay := schedule.Next(0); delay < time.Hour || delay >= time.Hour+10*time.Minute {
+			t.Fatalf("Next(0) = %v; ожидается от 1h до 1h10m", delay)
+		}
+	}
+
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+	for _, test := range tests {
+		if result := schedule.Next(test.failures); result != test.expected {
+			t.Errorf("Next(%d) = %v; ожидается %v", test.failures, result, test.expected)
+		}
+	}
+}
+
+// Тест для Config.Schedule
+func TestConfigSchedule(t *testing.T) {
+	config := &Config{RefreshInterval: "6h", RefreshJitter: "0s"}
+	schedule, err := config.Schedule()
+	if err != nil {
+		t.Fatalf("Ошибка Schedule: %v", err)
+	}
+	if schedule.Interval != 6*time.Hour || schedule.Jitter != 0 || schedule.RetryMin != DefaultRetryMin {
+		t.Errorf("Schedule() = %+v", schedule)
+	}
+
+	for _, invalid := range []Config{{RefreshInterval: "день"}, {RefreshInterval: "0s"}, {RetryMin: "2h", RetryMax: "1h"}, {RefreshJitter: "-1m"}} {
+		if _, err = invalid.Schedule(); err == nil {
+			t.Errorf("Schedule(%+v) должна вернуть ошибку", invalid)
+		}
+	}
+}
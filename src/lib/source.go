@@ -0,0 +1,188 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Типы источников подсетей
+const (
+	SourceRIPEstat  = "ripestat"
+	SourceDelegated = "delegated"
+	SourceASN       = "asn"
+	SourceDNS       = "dns"
+	SourceMMDB      = "mmdb"
+)
+
+// Способы объединения источников профиля
+const (
+	CombineUnion     = "union"
+	CombineIntersect = "intersect"
+)
+
+// Source - источник подсетей профиля. Профиль без sources берет ресурсы
+// стран из country_code и country_codes в RIPEstat.
+type Source struct {
+	Type string `json:"type"`
+	// Countries - коды стран источника, по умолчанию страны профиля
+	Countries []string `json:"countries"`
+	// Fallback - источник используется, только если не удалось загрузить предыдущий
+	Fallback bool `json:"fallback"`
+
+	// Registry - RIR для delegated: ripencc, arin, apnic, lacnic, afrinic
+	Registry string `json:"registry"`
+	// URL или Path - откуда загрузить файл источника: delegated вместо адреса
+	// по умолчанию, база стран mmdb, сохраненный ответ asn
+	URL  string `json:"url"`
+	Path string `json:"path"`
+	// Statuses - учитываемые статусы записей delegated, по умолчанию allocated и assigned
+	Statuses []string `json:"statuses"`
+	// ASNs - автономные системы, анонсы которых запрашиваются в RIPEstat
+	ASNs []string `json:"asns"`
+
+	// Domains - имена, адреса которых добавляются в набор
+	Domains []string `json:"domains"`
+	// Resolver - сервер DNS host:port, по умолчанию nameserver из /etc/resolv.conf
+	Resolver string `json:"resolver"`
+	// PrefixV4 и PrefixV6 - до какой подсети расширяются адреса, по умолчанию /32 и /128
+	PrefixV4 int `json:"prefix_v4"`
+	PrefixV6 int `json:"prefix_v6"`
+}
+
+// DataSources возвращает источники профиля с подставленными значениями по
+// умолчанию. Профилю без стран, у которого есть только подсети, добавленные
+// вручную, источники не нужны.
+func (p *Profile) DataSources() []Source {
+	if len(p.Sources) == 0 {
+		if len(p.Countries()) == 0 && (len(p.IncludedSubnets) > 0 || len(p.IncludedFiles) > 0) {
+			return nil
+		}
+		return []Source{{Type: SourceRIPEstat, Countries: p.Countries()}}
+	}
+	sources := make([]Source, len(p.Sources))
+	for i, source := range p.Sources {
+		source.Type = strings.ToLower(source.Type)
+		source.Countries = normalizeCountries(source.Countries)
+		if len(source.Countries) == 0 {
+			source.Countries = p.Countries()
+		}
+		if source.Type == SourceDelegated {
+			source.Statuses = normalizeStatuses(source.Statuses)
+		}
+		sources[i] = source
+	}
+	return sources
+}
+
+// ByCountry сообщает, что источник выбирает ресурсы по кодам стран
+func (s *Source) ByCountry() bool {
+	return s.Type == SourceRIPEstat || s.Type == SourceDelegated || s.Type == SourceMMDB
+}
+
+// PrefixBits возвращает длину подсети, до которой расширяется адрес из DNS
+func (s *Source) PrefixBits(v4 bool) int {
+	if v4 {
+		if s.PrefixV4 == 0 {
+			return 32
+		}
+		return s.PrefixV4
+	}
+	if s.PrefixV6 == 0 {
+		return 128
+	}
+	return s.PrefixV6
+}
+
+// Location возвращает путь или URL файла источника
+func (s *Source) Location() string {
+	if s.Path != "" {
+		return s.Path
+	}
+	if s.URL != "" {
+		return s.URL
+	}
+	if s.Type == SourceDelegated {
+		return DelegatedURLs[strings.ToLower(s.Registry)]
+	}
+	return ""
+}
+
+// String возвращает краткое описание источника для сообщений
+func (s *Source) String() string {
+	if s.Type == SourceDelegated && s.Path == "" && s.URL == "" {
+		return s.Type + " " + strings.ToLower(s.Registry)
+	}
+	if location := s.Path + s.URL; location != "" {
+		return s.Type + " " + location
+	}
+	return s.Type
+}
+
+// validate проверяет тип источника и обязательные для него поля
+func (s *Source) validate() error {
+	switch strings.ToLower(s.Type) {
+	case SourceRIPEstat:
+	case SourceDelegated:
+		if s.Path != "" && s.URL != "" {
+			return fmt.Errorf("источник delegated: заданы одновременно path и url")
+		}
+		if s.Path == "" && s.URL == "" {
+			if _, ok := DelegatedURLs[strings.ToLower(s.Registry)]; !ok {
+				return fmt.Errorf("источник delegated: неизвестный registry %q", s.Registry)
+			}
+		}
+	case SourceASN:
+		if (s.Path == "") == (len(s.ASNs) == 0) {
+			return fmt.Errorf("источник asn: нужно задать либо asns, либо path")
+		}
+		for _, asn := range s.ASNs {
+			if _, err := ParseASN(asn); err != nil {
+				return fmt.Errorf("источник asn: %v", err)
+			}
+		}
+	case SourceDNS:
+		if len(s.Domains) == 0 {
+			return fmt.Errorf("источник dns: не задан список domains")
+		}
+		if s.PrefixV4 < 0 || s.PrefixV4 > 32 || s.PrefixV6 < 0 || s.PrefixV6 > 128 {
+			return fmt.Errorf("источник dns: некорректная длина prefix_v4 или prefix_v6")
+		}
+	case SourceMMDB:
+		if (s.Path == "") == (s.URL == "") {
+			return fmt.Errorf("источник mmdb: нужно задать либо path, либо url")
+		}
+	case "":
+		return fmt.Errorf("у источника не задан type")
+	default:
+		return fmt.Errorf("неизвестный тип источника %s", s.Type)
+	}
+	return nil
+}
+
+// normalizeCountries приводит коды стран к верхнему регистру и убирает повторы
+func normalizeCountries(codes []string) []string {
+	var countries []string
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+		countries = append(countries, code)
+	}
+	return countries
+}
+
+// normalizeStatuses приводит статусы delegated к нижнему регистру,
+// пустой список заменяется статусами по умолчанию
+func normalizeStatuses(statuses []string) []string {
+	if len(statuses) == 0 {
+		return DefaultDelegatedStatuses
+	}
+	normalized := make([]string, len(statuses))
+	for i, status := range statuses {
+		normalized[i] = strings.ToLower(strings.TrimSpace(status))
+	}
+	return normalized
+}
@@ -0,0 +1,196 @@
+//go:build linux
+
+package lib
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Группы рассылки rtnetlink из linux/rtnetlink.h, в пакете syscall их нет
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv6IfAddr = 0x100
+)
+
+// WatchLinks следит за событиями netlink об интерфейсах и адресах и
+// отправляет в канал имя интерфейса из names, когда он поднялся или получил
+// первый адрес. Канал закрывается после закрытия stop или при ошибке чтения.
+func WatchLinks(names []string, stop <-chan struct{}) (<-chan string, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия netlink сокета: %v", err)
+	}
+	groups := uint32(rtmgrpLink | rtmgrpIPv4IfAddr | rtmgrpIPv6IfAddr)
+	if err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: groups}); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("ошибка подписки на события netlink: %v", err)
+	}
+	// Чтение прерывается раз в секунду, чтобы заметить закрытие stop
+	timeout := syscall.Timeval{Sec: 1}
+	if err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("ошибка настройки netlink сокета: %v", err)
+	}
+
+	watched := make(map[string]bool)
+	for _, name := range names {
+		watched[name] = true
+	}
+
+	events := make(chan string)
+	go func() {
+		defer close(events)
+		defer syscall.Close(fd)
+
+		links := make(map[uint32]*linkState)
+		buf := make([]byte, 1<<16)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			switch err {
+			case nil:
+			case syscall.EAGAIN, syscall.EINTR:
+				continue
+			case syscall.ENOBUFS:
+				// Часть событий потеряна, следующие все равно придут
+				continue
+			default:
+				fmt.Printf("Ошибка чтения событий netlink: %v\n", err)
+				return
+			}
+
+			msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+			for _, msg := range msgs {
+				name := linkEvent(msg, links)
+				if name == "" || !watched[name] {
+					continue
+				}
+				select {
+				case events <- name:
+				case <-stop:
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// linkState - последнее известное состояние интерфейса
+type linkState struct {
+	name    string
+	running bool
+	// addrs - адреса интерфейса в виде длины префикса и байтов адреса
+	addrs map[string]bool
+}
+
+// linkEvent возвращает имя интерфейса, если сообщение означает, что он
+// перешел в рабочее состояние или получил первый адрес. links хранит
+// состояние интерфейсов по индексу, чтобы не реагировать на повторные
+// события: ядро присылает RTM_NEWADDR и при обновлении уже известного адреса.
+func linkEvent(msg syscall.NetlinkMessage, links map[uint32]*linkState) string {
+	switch msg.Header.Type {
+	case syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+		if len(msg.Data) < syscall.SizeofIfInfomsg {
+			return ""
+		}
+		index := binary.NativeEndian.Uint32(msg.Data[4:8])
+		flags := binary.NativeEndian.Uint32(msg.Data[8:12])
+		name := linkName(msg)
+		if name == "" {
+			return ""
+		}
+		if msg.Header.Type == syscall.RTM_DELLINK {
+			delete(links, index)
+			return ""
+		}
+		link := links[index]
+		if link == nil {
+			link = &linkState{addrs: make(map[string]bool)}
+			links[index] = link
+		}
+		running := flags&syscall.IFF_UP != 0 && flags&syscall.IFF_RUNNING != 0
+		wasRunning := link.running
+		link.name, link.running = name, running
+		if running && !wasRunning {
+			return name
+		}
+	case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+		if len(msg.Data) < syscall.SizeofIfAddrmsg {
+			return ""
+		}
+		index := binary.NativeEndian.Uint32(msg.Data[4:8])
+		key := addrKey(msg)
+		link := links[index]
+		if link == nil {
+			if msg.Header.Type == syscall.RTM_DELADDR {
+				return ""
+			}
+			// О состоянии интерфейса еще не было событий: считаем его рабочим
+			iface, err := net.InterfaceByIndex(int(index))
+			if err != nil {
+				return ""
+			}
+			link = &linkState{name: iface.Name, running: true, addrs: make(map[string]bool)}
+			links[index] = link
+		}
+		if msg.Header.Type == syscall.RTM_DELADDR {
+			delete(link.addrs, key)
+			return ""
+		}
+		first := len(link.addrs) == 0
+		link.addrs[key] = true
+		// Адрес на опущенном интерфейсе учтет событие RTM_NEWLINK при подъеме
+		if first && link.running {
+			return link.name
+		}
+	}
+	return ""
+}
+
+// addrKey возвращает длину префикса и адрес из сообщения об адресе
+func addrKey(msg syscall.NetlinkMessage) string {
+	attrs, err := syscall.ParseNetlinkRouteAttr(&msg)
+	if err != nil {
+		return ""
+	}
+	var addr []byte
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case syscall.IFA_LOCAL:
+			addr = attr.Value
+		case syscall.IFA_ADDRESS:
+			if addr == nil {
+				addr = attr.Value
+			}
+		}
+	}
+	return string(msg.Data[1:2]) + string(addr)
+}
+
+// linkName извлекает имя интерфейса из атрибута IFLA_IFNAME
+func linkName(msg syscall.NetlinkMessage) string {
+	attrs, err := syscall.ParseNetlinkRouteAttr(&msg)
+	if err != nil {
+		return ""
+	}
+	for _, attr := range attrs {
+		if attr.Attr.Type == syscall.IFLA_IFNAME {
+			return strings.TrimRight(string(attr.Value), "\x00")
+		}
+	}
+	return ""
+}
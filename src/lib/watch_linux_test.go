@@ -0,0 +1,63 @@
+package lib
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"syscall"
+	"testing"
+)
+
+// linkMessage собирает сообщение RTM_NEWLINK или RTM_DELLINK для интерфейса
+func linkMessage(msgType uint16, index uint32, name string, flags uint32) syscall.NetlinkMessage {
+	data := make([]byte, syscall.SizeofIfInfomsg)
+	binary.NativeEndian.PutUint32(data[4:8], index)
+	binary.NativeEndian.PutUint32(data[8:12], flags)
+	data = appendRtAttr(data, syscall.IFLA_IFNAME, append([]byte(name), 0))
+	return syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: msgType}, Data: data}
+}
+
+// addrMessage собирает сообщение RTM_NEWADDR или RTM_DELADDR для адреса интерфейса
+func addrMessage(msgType uint16, index uint32, prefix string) syscall.NetlinkMessage {
+	p := netip.MustParsePrefix(prefix)
+	data := make([]byte, syscall.SizeofIfAddrmsg)
+	data[0], data[1] = syscall.AF_INET, byte(p.Bits())
+	if p.Addr().Is6() {
+		data[0] = syscall.AF_INET6
+	}
+	binary.NativeEndian.PutUint32(data[4:8], index)
+	data = appendRtAttr(data, syscall.IFA_ADDRESS, p.Addr().AsSlice())
+	return syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: msgType}, Data: data}
+}
+
+// Тест для linkEvent: событие только при переходе интерфейса в рабочее
+// состояние или при первом адресе, повторный RTM_NEWADDR ничего не вызывает
+func TestLinkEvent(t *testing.T) {
+	running := uint32(syscall.IFF_UP | syscall.IFF_RUNNING)
+	tests := []struct {
+		msg      syscall.NetlinkMessage
+		expected string
+	}{
+		{linkMessage(syscall.RTM_NEWLINK, 5, "ppp0", syscall.IFF_UP), ""},
+		{linkMessage(syscall.RTM_NEWLINK, 5, "ppp0", running), "ppp0"},
+		{linkMessage(syscall.RTM_NEWLINK, 5, "ppp0", running), ""},
+		{addrMessage(syscall.RTM_NEWADDR, 5, "10.64.0.2/32"), "ppp0"},
+		{addrMessage(syscall.RTM_NEWADDR, 5, "10.64.0.2/32"), ""},
+		{addrMessage(syscall.RTM_NEWADDR, 5, "fe80::1/64"), ""},
+		{addrMessage(syscall.RTM_DELADDR, 5, "10.64.0.2/32"), ""},
+		{addrMessage(syscall.RTM_DELADDR, 5, "fe80::1/64"), ""},
+		{linkMessage(syscall.RTM_NEWLINK, 5, "ppp0", syscall.IFF_UP), ""},
+		{addrMessage(syscall.RTM_NEWADDR, 5, "10.64.0.3/32"), ""},
+		{linkMessage(syscall.RTM_NEWLINK, 5, "ppp0", running), "ppp0"},
+		{addrMessage(syscall.RTM_NEWADDR, 5, "10.64.0.3/32"), ""},
+		{linkMessage(syscall.RTM_DELLINK, 5, "ppp0", running), ""},
+		{linkMessage(syscall.RTM_NEWLINK, 6, "ppp0", running), "ppp0"},
+		{linkMessage(syscall.RTM_NEWLINK, 7, "wg0", running), "wg0"},
+	}
+
+	links := make(map[uint32]*linkState)
+	for i, test := range tests {
+		if result := linkEvent(test.msg, links); result != test.expected {
+			t.Errorf("linkEvent(#%d) = %q; ожидается %q", i, result, test.expected)
+		}
+	}
+}
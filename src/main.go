@@ -1,389 +1,206 @@
 package main
 
 import (
-	"encoding/json"
-	"flag"
+	"errors"
 	"fmt"
-	"io"
-	"net"
-	"net/http"
 	"os"
-	"sort"
+	"slices"
 	"strings"
 
 	"github.com/Max121279/routing_ripe/src/lib"
 )
 
-const baseURL = "https://stat.ripe.net/data/country-resource-list/data.json?resource="
-
-func fetchSubnets(config *lib.Config) ([]string, error) {
-	url := baseURL + config.CountryCode
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка загрузки данных: %v", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения ответа: %v", err)
-	}
-
-	var result struct {
-		Data struct {
-			Resources struct {
-				IPv4 []string `json:"ipv4"`
-			} `json:"resources"`
-		} `json:"data"`
-	}
-	if err = json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("ошибка разбора JSON: %v", err)
-	}
-
-	ignoredIPs := make(map[string]bool)
-	for _, ip := range config.IgnoredIPs {
-		ignoredIPs[ip] = true
-	}
-
-	var subnets []string
-	for _, resource := range result.Data.Resources.IPv4 {
-		if strings.Contains(resource, "-") {
-			ips := strings.Split(resource, "-")
-			if len(ips) == 2 {
-				cidrs, _ := ipRangeToCIDR(ips[0], ips[1])
-				for _, cidr := range cidrs {
-					//filtered, _ := filterSubnets(cidr, ignoredIPs)
-					filtered, _ := lib.SummarizeSubnetsWithExclusions(cidr, ignoredIPs)
-					subnets = append(subnets, filtered...)
-				}
-			}
-		} else {
-			//filtered, _ := filterSubnets(resource, ignoredIPs)
-			filtered, _ := lib.SummarizeSubnetsWithExclusions(resource, ignoredIPs)
-			subnets = append(subnets, filtered...)
-		}
-	}
-
-	return summarizeSubnets(subnets), nil
+// Главная функция
+func main() {
+	os.Exit(run(os.Args[1:]))
 }
 
-func ipRangeToCIDR(start, end string) ([]string, error) {
-	startIP := net.ParseIP(start).To4()
-	endIP := net.ParseIP(end).To4()
-	if startIP == nil || endIP == nil {
-		return nil, fmt.Errorf("некорректный формат IP: %s - %s", start, end)
+// run выполняет подкоманду из аргументов и возвращает код завершения
+func run(args []string) int {
+	name, args := commandArgs(args)
+	if name == "help" {
+		printUsage()
+		return 0
 	}
-
-	var result []string
-	for bytesCompare(startIP, endIP) <= 0 {
-		mask := 32
-		for mask > 0 {
-			mask--
-			network := startIP.Mask(net.CIDRMask(mask, 32))
-			if bytesCompare(network, startIP) != 0 || bytesCompare(lastIPInCIDR(network, mask), endIP) > 0 {
-				mask++
-				break
-			}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(newFlagSet(cmd), args)
 		}
-
-		cidr := fmt.Sprintf("%s/%d", startIP.String(), mask)
-		result = append(result, cidr)
-		startIP = lib.NextIPInRange(lastIPInCIDR(startIP, mask), net.CIDRMask(32, 32))
 	}
+	fmt.Printf("Неизвестная команда %s\n\n", name)
+	printUsage()
+	return exitUsage
+}
 
-	return result, nil
+// legacyFlags - прежние флаги и подкоманды, которые их заменяют
+var legacyFlags = map[string][]string{
+	"-d":      {"remove"},
+	"-s":      {"apply", "-add-only"},
+	"-p":      {"plan"},
+	"-w":      {"watch"},
+	"-daemon": {"daemon"},
 }
 
-func summarizeSubnets(subnets []string) []string {
-	ipNets := make([]net.IPNet, len(subnets))
-	for i, subnet := range subnets {
-		_, ipNet, _ := net.ParseCIDR(subnet)
-		ipNets[i] = *ipNet
+// commandArgs возвращает имя подкоманды и ее аргументы. Без аргументов
+// выполняется apply, прежние флаги -d, -s, -p переводятся в подкоманды,
+// чтобы старые записи crontab продолжали работать.
+func commandArgs(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "apply", nil
 	}
-
-	sort.Sort(lib.ByNumericalValue(ipNets))
-
-	var summarized []net.IPNet
-	for _, ipNet := range ipNets {
-		if len(summarized) == 0 {
-			summarized = append(summarized, ipNet)
-			continue
-		}
-
-		last := summarized[len(summarized)-1]
-		if canMerge(last, ipNet) {
-			merged := mergeSubnets(last, ipNet)
-			summarized[len(summarized)-1] = merged
-		} else {
-			summarized = append(summarized, ipNet)
-		}
+	if legacy, ok := legacyFlags[args[0]]; ok {
+		return legacy[0], append(slices.Clone(legacy[1:]), args[1:]...)
 	}
-
-	// Преобразуем в строковый формат
-	result := make([]string, len(summarized))
-	for i, net := range summarized {
-		result[i] = net.String()
+	switch {
+	case args[0] == "-h" || args[0] == "-help" || args[0] == "--help":
+		return "help", nil
+	case strings.HasPrefix(args[0], "-"):
+		return "apply", args
 	}
-
-	return result
+	return args[0], args[1:]
 }
 
-func lastIPInCIDR(ip net.IP, prefixSize int) net.IP {
-	mask := net.CIDRMask(prefixSize, 32)
-	network := ip.Mask(mask)
-	broadcast := make(net.IP, len(network))
-	copy(broadcast, network)
-	for i := 0; i < len(broadcast); i++ {
-		broadcast[i] |= ^mask[i]
-	}
-	return broadcast
+// environment - конфигурация и бэкенды профилей, с которыми работает команда
+type environment struct {
+	// configPath - откуда загружена конфигурация, для перечитывания по SIGHUP
+	configPath string
+	config     *lib.Config
+	backends   map[string]lib.RouteBackend
+	// only - профиль, которым ограничена команда; пусто - все профили
+	only string
+	// stale - при последнем запросе часть данных взята из кэша
+	stale bool
 }
 
-func filterSubnets(cidr string, ignoredIPs map[string]bool) ([]string, error) {
-	_, ipNet, err := net.ParseCIDR(cidr)
+// loadEnvironment загружает конфигурацию и создает бэкенды профилей
+func loadEnvironment(configPath, only string) (*environment, error) {
+	config, err := lib.LoadConfig(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка разбора подсети %s: %v", cidr, err)
+		return nil, err
 	}
-
-	var result []string
-	for ip := ipNet.IP.Mask(ipNet.Mask); ipNet.Contains(ip); ip = lib.NextIPInRange(ip, net.CIDRMask(32, 32)) {
-		if !ignoredIPs[ip.String()] {
-			result = append(result, ip.String()+"/32")
-		}
-	}
-
-	return result, nil
-}
-
-// summarizeSubnetsWithExclusions - основная функция для суммаризации подсетей с исключениями
-func summarizeSubnetsWithExclusions(subnets []string, excludedIPs map[string]bool) ([]string, error) {
-	var result []*net.IPNet
-
-	// Перебираем все подсети
-	for _, subnet := range subnets {
-		_, ipNet, err := net.ParseCIDR(subnet)
-		if err != nil {
-			return nil, fmt.Errorf("ошибка разбора подсети %s: %v", subnet, err)
-		}
-
-		// Разделяем подсеть с учётом исключаемых IP
-		result = append(result, splitSubnetWithExclusions(ipNet, excludedIPs)...)
+	backends, err := newBackends(config)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выбора бэкенда маршрутов: %v", err)
 	}
-
-	// Преобразуем результат в строковый формат и возвращаем
-	var summarized []string
-	for _, net := range result {
-		summarized = append(summarized, net.String())
+	env := &environment{configPath: configPath, config: config, backends: backends, only: only}
+	if only != "" && len(env.profiles()) == 0 {
+		return nil, fmt.Errorf("профиль %s не найден", only)
 	}
-
-	return summarized, nil
+	return env, nil
 }
 
-// splitSubnetWithExclusions делит подсеть на два сегмента и исключает IP
-func splitSubnetWithExclusions(ipNet *net.IPNet, excludedIPs map[string]bool) []*net.IPNet {
-	queue := []*net.IPNet{ipNet}
-	var result []*net.IPNet
-
-	for len(queue) > 0 {
-		current := queue[0]
-		queue = queue[1:]
-
-		// Проверяем, содержится ли исключаемый IP в текущей подсети
-		var containsExcluded bool
-		for ip := range excludedIPs {
-			if current.Contains(net.ParseIP(ip)) {
-				containsExcluded = true
-				break
-			}
-		}
-
-		// Если в подсети нет исключаемых адресов, добавляем её в результат
-		if !containsExcluded {
-			result = append(result, current)
-			continue
-		}
-
-		// Если подсеть минимальна (/32), добавляем её и продолжаем
-		maskSize, bits := current.Mask.Size()
-		if maskSize == bits {
-			result = append(result, current)
-			continue
-		}
-
-		// Разделяем подсеть на два сегмента
-		nextMask := maskSize + 1
-		left := &net.IPNet{
-			IP:   current.IP.Mask(net.CIDRMask(nextMask, bits)),
-			Mask: net.CIDRMask(nextMask, bits),
-		}
-		right := &net.IPNet{
-			IP:   lib.NextIPInRange(left.IP, left.Mask),
-			Mask: net.CIDRMask(nextMask, bits),
-		}
-
-		// Если исключаемый адрес не входит в оба сегмента, добавляем поддиапазоны в результат
-		shouldAddLeft := true
-		shouldAddRight := true
-		for ip := range excludedIPs {
-			excludedIP := net.ParseIP(ip)
-			if left.Contains(excludedIP) {
-				shouldAddLeft = false
-			}
-			if right.Contains(excludedIP) {
-				shouldAddRight = false
-			}
-		}
-
-		// Добавляем только те сегменты, которые не содержат исключаемые адреса
-		if shouldAddLeft {
-			result = append(result, left)
-		}
-		if shouldAddRight {
-			result = append(result, right)
-		}
-
-		// Добавляем оба сегмента в очередь для дальнейшей обработки
-		if shouldAddLeft {
-			queue = append(queue, left)
-		}
-		if shouldAddRight {
-			queue = append(queue, right)
+// profiles возвращает профили, с которыми работает команда
+func (e *environment) profiles() []lib.Profile {
+	var profiles []lib.Profile
+	for _, profile := range e.config.RoutingProfiles() {
+		if e.selected(profile.Name) {
+			profiles = append(profiles, profile)
 		}
 	}
-
-	return result
+	return profiles
 }
 
-func canMerge(a, b net.IPNet) bool {
-	sizeA, bits := a.Mask.Size()
-	sizeB, _ := b.Mask.Size()
-	if sizeA != sizeB || bits != 32 {
-		return false
-	}
-
-	// Проверяем, являются ли подсети последовательными
-	nextIP := lib.NextIPInRange(a.IP, a.Mask)
-	// проверяем начало сети совпадает с А
-	newMask := net.CIDRMask(sizeA-1, bits)
-	if bytesCompare(a.IP.Mask(newMask), a.IP) != 0 {
-		return false
-	}
-	return bytesCompare(nextIP, b.IP) == 0
+func (e *environment) selected(name string) bool {
+	return e.only == "" || e.only == name
 }
 
-func mergeSubnets(a, b net.IPNet) net.IPNet {
-	size, bits := a.Mask.Size()
-	newMask := net.CIDRMask(size-1, bits)
-	return net.IPNet{
-		IP:   a.IP.Mask(newMask),
-		Mask: newMask,
+// plans загружает и вычисляет наборы подсетей. Конфликты разрешаются
+// между всеми профилями, а возвращаются только выбранные.
+func (e *environment) plans() ([]profilePlan, []string, error) {
+	plans, warnings, stale, err := fetchSubnets(e.config)
+	e.stale = stale
+	if err != nil {
+		return nil, warnings, err
 	}
-}
-
-func bytesCompare(a, b net.IP) int {
-	for i := 0; i < len(a); i++ {
-		if a[i] < b[i] {
-			return -1
-		}
-		if a[i] > b[i] {
-			return 1
+	var selected []profilePlan
+	for _, plan := range plans {
+		if e.selected(plan.profile.Name) {
+			selected = append(selected, plan)
 		}
 	}
-	return 0
+	return selected, warnings, nil
 }
 
-// Главная функция
-func main() {
-	var configPath string = ""
-	// Определение флагов
-	removeOnly := flag.Bool("d", false, "Только удаление маршрутов")
-	addOnly := flag.Bool("s", false, "Только запрос и добавление маршрутов")
-	displayOnly := flag.Bool("p", false, "Только запрос и отображение данных")
-	flag.Parse()
-
-	// Загрузка конфигурации
-	value := os.Getenv("DEBUG")
-	if value == "" {
-		configPath = "/opt/routing/config.json"
-	} else {
-		configPath = "config.json"
-	}
-	config, err := lib.LoadConfig(configPath)
+// applyProfiles загружает, проверяет и вычисляет наборы профилей и
+// сверяет с ними маршруты. При ошибке получения данных маршруты не меняются.
+func applyProfiles(env *environment) int {
+	// Сначала загружаем, проверяем и вычисляем наборы всех профилей, и только
+	// потом меняем маршруты: при ошибке установленные маршруты остаются
+	fmt.Println("Запрос данных RIPE...")
+	plans, warnings, err := env.plans()
 	if err != nil {
-		fmt.Printf("Ошибка загрузки конфигурации: %v\n", err)
-		return
-	}
-
-	// Преобразование игнорируемых подсетей в map для быстрого доступа
-	ignoredSubnets := make(map[string]bool)
-	for _, subnet := range config.IgnoredSubnets {
-		ignoredSubnets[subnet] = true
+		return fetchFailed(err)
 	}
+	defer printWarnings(warnings)
 
-	// Выполнение действий в зависимости от флагов
-	switch {
-	case *removeOnly:
-		// Запускаем процесс обновления и применения маршрутов
-		fmt.Println("Очистка старых маршрутов...")
-		err = lib.RemoveRoutes(config.FilePath, config.Interface)
+	// Сверяем новый набор подсетей с предыдущим и меняем только разницу
+	code := 0
+	for _, plan := range plans {
+		fmt.Printf("Профиль %s: сверка маршрутов...\n", plan.profile.Name)
+		err = lib.ReconcileRoutes(env.backends[plan.profile.Name], plan.profile.FilePath, plan.subnets)
 		if err != nil {
-			fmt.Printf("Ошибка при удалении старых маршрутов: %v\n", err)
+			fmt.Printf("Ошибка при обновлении маршрутов: %v\n", err)
+			code = exitApply
 		}
-	case *addOnly:
-		fmt.Println("Запрос данных RIPE...")
-		subnets, err := fetchSubnets(config)
-		if err != nil {
-			panic(err)
-		}
-
-		fmt.Println("Обновление файла подсетей...")
-		err = lib.UpdateSubnetsFile(subnets, config.FilePath)
-		if err != nil {
-			fmt.Printf("Ошибка обновления файла: %v\n", err)
-			os.Exit(0)
+		if err = applyPolicy(&plan.profile); err != nil {
+			fmt.Printf("Ошибка при установке правил: %v\n", err)
+			code = exitApply
 		}
+	}
+	fmt.Println("Ожидание следующего обновления...")
+	return code
+}
 
-		// Добавление новых маршрутов
-		err = lib.AddRoutes(config.FilePath, config.Interface)
+// newBackends создает бэкенд маршрутов для каждого профиля
+func newBackends(config *lib.Config) (map[string]lib.RouteBackend, error) {
+	backends := make(map[string]lib.RouteBackend)
+	for _, profile := range config.RoutingProfiles() {
+		options, err := profile.RouteOptions()
 		if err != nil {
-			fmt.Printf("Ошибка при добавлении новых маршрутов: %v\n", err)
+			return nil, fmt.Errorf("профиль %s: %v", profile.Name, err)
 		}
-	case *displayOnly:
-		fmt.Println("Запрос данных RIPE...")
-		subnets, err := fetchSubnets(config)
+		backend, err := lib.NewRouteBackend(config.Backend, options)
 		if err != nil {
-			panic(err)
-		}
-		fmt.Println("Полученные подсети:")
-		for _, subnet := range subnets {
-			fmt.Println(subnet)
-		}
-	default:
-		// Запускаем процесс обновления и применения маршрутов
-		fmt.Println("Очистка старых маршрутов...")
-		err = lib.RemoveRoutes(config.FilePath, config.Interface)
-		if err != nil {
-			fmt.Printf("Ошибка при удалении старых маршрутов: %v\n", err)
+			return nil, fmt.Errorf("профиль %s: %v", profile.Name, err)
 		}
+		backends[profile.Name] = backend
+	}
+	return backends, nil
+}
 
-		fmt.Println("Запрос данных RIPE...")
-		subnets, err := fetchSubnets(config)
-		if err != nil {
-			panic(err)
-		}
+// applyPolicy устанавливает правила ip rule профиля, если он использует
+// отдельную таблицу. Правила ставятся после маршрутов, чтобы таблица не была пустой.
+func applyPolicy(profile *lib.Profile) error {
+	rules, err := profile.PolicyRules()
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	fmt.Printf("Профиль %s: проверка правил маршрутизации...\n", profile.Name)
+	return lib.EnsureRules(rules)
+}
 
-		fmt.Println("Обновление файла подсетей...")
-		err = lib.UpdateSubnetsFile(subnets, config.FilePath)
-		if err != nil {
-			fmt.Printf("Ошибка обновления файла: %v\n", err)
-			os.Exit(0)
-		}
+// removePolicy удаляет правила ip rule профиля
+func removePolicy(profile *lib.Profile) error {
+	rules, err := profile.PolicyRules()
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	return lib.RemoveRules(rules)
+}
 
-		// Добавление новых маршрутов
-		err = lib.AddRoutes(config.FilePath, config.Interface)
-		if err != nil {
-			fmt.Printf("Ошибка при добавлении новых маршрутов: %v\n", err)
-		}
-		fmt.Println("Ожидание следующего обновления...")
+// fetchFailed выводит ошибку этапа и возвращает его код завершения
+func fetchFailed(err error) int {
+	fmt.Printf("Ошибка получения подсетей, маршруты не изменены: %v\n", err)
+	var stageErr *stageError
+	if errors.As(err, &stageErr) {
+		return stageErr.code
+	}
+	return exitFetch
+}
+
+// printWarnings выводит предупреждения в конце запуска
+func printWarnings(warnings []string) {
+	for _, warning := range warnings {
+		fmt.Printf("ВНИМАНИЕ: %s\n", warning)
 	}
 }
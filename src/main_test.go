@@ -1,137 +1,517 @@
 package main
 
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Max121279/routing_ripe/src/lib"
+	"github.com/Max121279/routing_ripe/src/lib/cidrset"
+)
+
+// Тест для validateResources: пустые и некорректные данные не доходят до маршрутов
+func TestValidateResources(t *testing.T) {
+	tests := []struct {
+		resources []string
+		valid     bool
+	}{
+		{[]string{"5.8.0.0/16", "31.40.0.0-31.40.3.255"}, true},
+		{nil, false},
+		{[]string{"5.8.0.0/16", "<html>"}, false},
+		{[]string{"31.40.3.255-31.40.0.0"}, false},
+	}
+
+	for _, test := range tests {
+		err := validateResources([]sourceResources{{name: "RU", resources: test.resources}})
+		if (err == nil) != test.valid {
+			t.Errorf("validateResources(%v) = %v; ожидается корректность %v", test.resources, err, test.valid)
+		}
+	}
+}
+
+// Тест для unionResources: подсети, диапазоны и адреса разных источников
+// сливаются в один набор, а в ошибке называется источник
+func TestUnionResources(t *testing.T) {
+	sources := []sourceResources{
+		{name: "RU", resources: []string{"10.0.0.0/25", "10.0.1.0/24", "2a00:1fa0::/29"}},
+		{name: "BY", resources: []string{"10.0.0.128-10.0.0.255", "10.0.0.64/26", "10.0.2.0"}},
+	}
+	set, err := unionResources(sources)
+	if err != nil {
+		t.Fatalf("Ошибка unionResources: %v", err)
+	}
+	expected := []string{"10.0.0.0/23", "10.0.2.0/32", "2a00:1fa0::/29"}
+	if result := set.Strings(); !reflect.DeepEqual(result, expected) {
+		t.Errorf("unionResources() = %v; ожидается %v", result, expected)
+	}
+
+	sources = append(sources, sourceResources{name: "AS15169", resources: []string{"8.8.8.0/33"}})
+	if _, err = unionResources(sources); err == nil || !strings.HasPrefix(err.Error(), "AS15169: ") {
+		t.Errorf("unionResources() = %v; ожидается ошибка источника AS15169", err)
+	}
+}
+
+// Тест для computeSubnets
+func TestComputeSubnets(t *testing.T) {
+	profile := &lib.Profile{IgnoredIPs: []string{"10.0.0.1"}}
+	sources := []sourceResources{
+		{name: "RU", resources: []string{"10.0.0.0/30"}},
+		{name: "BY", resources: []string{"10.0.0.4-10.0.0.7"}},
+	}
+	set, err := computeSubnets(profile, sources, nil)
+	if err != nil {
+		t.Fatalf("Ошибка computeSubnets: %v", err)
+	}
+
+	expected := []string{"10.0.0.0/32", "10.0.0.2/31", "10.0.0.4/30"}
+	if result := set.Strings(); !reflect.DeepEqual(result, expected) {
+		t.Errorf("computeSubnets() = %v; ожидается %v", result, expected)
+	}
+}
+
+// Тест для computeSubnets в режиме invert
+func TestComputeSubnetsInvert(t *testing.T) {
+	profile := &lib.Profile{Invert: true}
+	sources := []sourceResources{{name: "RU", resources: []string{"1.0.0.0/8", "2.0.0.0/7", "4.0.0.0/6", "8.0.0.0/7"}}}
+	set, err := computeSubnets(profile, sources, nil)
+	if err != nil {
+		t.Fatalf("Ошибка computeSubnets: %v", err)
+	}
+	result := set.Strings()
+
+	// 0.0.0.0/8 и 10.0.0.0/8 не публичные, поэтому первая подсеть - 11.0.0.0/8
+	if len(result) == 0 || result[0] != "11.0.0.0/8" {
+		t.Errorf("computeSubnets() начинается с %v; ожидается 11.0.0.0/8", result[:min(3, len(result))])
+	}
+	for _, subnet := range []string{"1.0.0.0/8", "10.0.0.0/8", "192.168.0.0/16"} {
+		for _, got := range result {
+			if got == subnet {
+				t.Errorf("computeSubnets() содержит %s", subnet)
+			}
+		}
+	}
+}
+
+// Тест для computeSubnets с combine: ресурсы одного источника всегда
+// объединяются, а наборы разных источников - объединяются или пересекаются
+func TestComputeSubnetsCombine(t *testing.T) {
+	sources := []sourceResources{
+		{name: "RU (ripestat)", resources: []string{"10.0.0.0/24"}, group: 0},
+		{name: "BY (ripestat)", resources: []string{"10.0.2.0/24"}, group: 0},
+		{name: "RU (mmdb)", resources: []string{"10.0.0.128/25", "10.0.1.0/24"}, group: 1},
+		{name: "BY (mmdb)", resources: []string{"10.0.2.0/25"}, group: 1},
+	}
+
+	tests := []struct {
+		combine  string
+		expected []string
+	}{
+		{"", []string{"10.0.0.0/23", "10.0.2.0/24"}},
+		{"union", []string{"10.0.0.0/23", "10.0.2.0/24"}},
+		{"intersect", []string{"10.0.0.128/25", "10.0.2.0/25"}},
+	}
+
+	for _, test := range tests {
+		set, err := computeSubnets(&lib.Profile{Combine: test.combine}, sources, nil)
+		if err != nil {
+			t.Fatalf("Ошибка computeSubnets(%s): %v", test.combine, err)
+		}
+		if result := set.Strings(); !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("computeSubnets(%s) = %v; ожидается %v", test.combine, result, test.expected)
+		}
+	}
+}
+
+// Тест для computeSubnets с подсетями, добавленными вручную: они не
+// инвертируются, но игнорируемые адреса из них исключаются
+func TestComputeSubnetsIncludes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "include.txt")
+	data := "# партнеры\n198.51.100.0/24 # офис\n\n203.0.113.8-203.0.113.11\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	profile := &lib.Profile{
+		IncludedSubnets: []string{"192.0.2.10/32", "2001:db8::/32"},
+		IncludedFiles:   []string{path},
+		IgnoredIPs:      []string{"198.51.100.1"},
+	}
+
+	includes, err := includedResources(profile)
+	if err != nil {
+		t.Fatalf("Ошибка includedResources: %v", err)
+	}
+	sources := []sourceResources{{name: "RU", resources: []string{"10.0.0.0/30"}}}
+	set, err := computeSubnets(profile, sources, includes)
+	if err != nil {
+		t.Fatalf("Ошибка computeSubnets: %v", err)
+	}
+	result := set.Strings()
+	for _, subnet := range []string{"10.0.0.0/30", "192.0.2.10/32", "198.51.100.128/25", "203.0.113.8/30"} {
+		if !slices.Contains(result, subnet) {
+			t.Errorf("computeSubnets() = %v; ожидается %s", result, subnet)
+		}
+	}
+	for _, subnet := range []string{"198.51.100.0/24", "198.51.100.1/32", "2001:db8::/32"} {
+		if slices.Contains(result, subnet) {
+			t.Errorf("computeSubnets() содержит %s", subnet)
+		}
+	}
+
+	// При invert добавленные подсети остаются в наборе
+	profile = &lib.Profile{Invert: true, IncludedSubnets: []string{"5.8.0.1/32"}}
+	includes, _ = includedResources(profile)
+	set, err = computeSubnets(profile, []sourceResources{{name: "RU", resources: []string{"5.0.0.0/8"}}}, includes)
+	if err != nil {
+		t.Fatalf("Ошибка computeSubnets: %v", err)
+	}
+	if result = set.Strings(); !slices.Contains(result, "5.8.0.1/32") {
+		t.Errorf("computeSubnets() с invert не содержит 5.8.0.1/32")
+	}
+
+	if _, err = includedResources(&lib.Profile{IncludedFiles: []string{path + ".missing"}}); err == nil {
+		t.Error("includedResources() должна вернуть ошибку для отсутствующего файла")
+	}
+}
+
+// Тест для fetchResources: источник с fallback используется, только если
+// не удалось загрузить предыдущий
+func TestFetchResourcesFallback(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "delegated-ripencc-extended-latest")
+	data := "ripencc|RU|ipv4|2.56.0.0|1024|20190101|allocated|a1\nripencc|RU|ipv6|2a00:1fa0::|29|20120101|allocated|a1\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		sources  []lib.Source
+		expected []string
+		warnings int
+	}{
+		{[]lib.Source{{Type: "delegated", Path: path}, {Type: "delegated", Path: missing, Fallback: true}}, []string{"2.56.0.0-2.56.3.255"}, 0},
+		{[]lib.Source{{Type: "delegated", Path: missing}, {Type: "delegated", Path: path, Fallback: true}}, []string{"2.56.0.0-2.56.3.255"}, 1},
+		{[]lib.Source{{Type: "delegated", Path: missing}, {Type: "delegated", Path: missing, Fallback: true}}, nil, 0},
+	}
+
+	for _, test := range tests {
+		f := newFetcher(nil)
+		profile := &lib.Profile{CountryCode: "RU", Sources: test.sources}
+		resources, err := f.fetchResources(profile)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("fetchResources(%v) должна вернуть ошибку", test.sources)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Ошибка fetchResources(%v): %v", test.sources, err)
+		}
+		if len(resources) != 1 || !reflect.DeepEqual(resources[0].resources, test.expected) {
+			t.Errorf("fetchResources(%v) = %v; ожидается %v", test.sources, resources, test.expected)
+		}
+		if len(f.warnings) != test.warnings {
+			t.Errorf("fetchResources(%v): предупреждения %v; ожидается %d", test.sources, f.warnings, test.warnings)
+		}
+	}
+}
+
+// Тест для fetchResources с источником asn из сохраненного файла: без ipv6
+// подсети IPv6 не попадают в набор, а AS только с IPv6 пропускается
+func TestFetchResourcesASNDump(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "as15169.json")
+	data := `{"status": "ok", "data": {"prefixes": [{"prefix": "8.8.8.0/24"}, {"prefix": "2001:4860::/32"}]}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pathV6 := filepath.Join(dir, "as6939.json")
+	data = `{"status": "ok", "data": {"prefixes": [{"prefix": "2001:470::/32"}]}}`
+	if err := os.WriteFile(pathV6, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		ipv6     bool
+		expected []string
+		warnings int
+	}{
+		{path, false, []string{"8.8.8.0/24"}, 0},
+		{path, true, []string{"8.8.8.0/24", "2001:4860::/32"}, 0},
+		{pathV6, false, nil, 1},
+		{pathV6, true, []string{"2001:470::/32"}, 0},
+	}
+
+	for _, test := range tests {
+		f := newFetcher(nil)
+		profile := &lib.Profile{IPv6: test.ipv6, Sources: []lib.Source{{Type: "asn", Path: test.path}}}
+		resources, err := f.fetchResources(profile)
+		if err != nil {
+			t.Fatalf("Ошибка fetchResources: %v", err)
+		}
+		if err = validateResources(resources); err != nil {
+			t.Errorf("validateResources(%s, ipv6 %v) = %v; ожидается nil", test.path, test.ipv6, err)
+		}
+		var result []string
+		if len(resources) == 1 {
+			result = resources[0].resources
+		}
+		if len(resources) > 1 || !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("fetchResources(%s, ipv6 %v) = %v; ожидается %v", test.path, test.ipv6, resources, test.expected)
+		}
+		if len(f.warnings) != test.warnings {
+			t.Errorf("fetchResources(%s, ipv6 %v): предупреждения %v; ожидается %d", test.path, test.ipv6, f.warnings, test.warnings)
+		}
+	}
+}
+
+// Тест для fetchResources с источником dns: при новом запуске, когда сервер
+// DNS не отвечает, используются адреса из кэша
+func TestFetchResourcesDNSCache(t *testing.T) {
+	server, conn := startDNSServer(t)
+	cache := &lib.Cache{Dir: t.TempDir(), MaxAge: time.Hour}
+	profile := &lib.Profile{Sources: []lib.Source{{Type: "dns", Domains: []string{"ok.test"}, Resolver: server}}}
+	expected := []sourceResources{{name: "ok.test", resources: []string{"192.0.2.1/32"}}}
+
+	f := newFetcher(cache)
+	resources, err := f.fetchResources(profile)
+	if err != nil || !reflect.DeepEqual(resources, expected) {
+		t.Fatalf("fetchResources() = %v, %v; ожидается %v", resources, err, expected)
+	}
+	f.saveResponses()
+
+	// Новый запуск: ответов в памяти нет, сервер DNS недоступен
+	conn.Close()
+	delete(resolvers, server)
+	resolverFor(server).Timeout = 100 * time.Millisecond
+	defer delete(resolvers, server)
+
+	f = newFetcher(cache)
+	resources, err = f.fetchResources(profile)
+	if err != nil || !reflect.DeepEqual(resources, expected) {
+		t.Errorf("fetchResources() из кэша = %v, %v; ожидается %v", resources, err, expected)
+	}
+	if len(f.warnings) != 1 || !f.stale {
+		t.Errorf("fetchResources() из кэша: предупреждения %v, stale %v; ожидается 1 и stale", f.warnings, f.stale)
+	}
+}
+
+// Тест для fetchResources с источником mmdb по url: после успешной проверки
+// база сохраняется в кэш и используется, когда сервер недоступен
+func TestFetchResourcesMMDBCache(t *testing.T) {
+	// База IPv4 из одного узла: левая запись ведет к данным RU, правая пустая
+	database := []byte{0, 0, 1 + 16, 0, 0, 1}
+	database = append(database, make([]byte, 16)...)
+	database = append(database, "\xe1\x47country\xe1\x48iso_code\x42RU"...)
+	database = append(database, "\xab\xcd\xefMaxMind.com"...)
+	database = append(database, "\xe3\x4anode_count\xc1\x01\x4brecord_size\xa1\x18\x4aip_version\xa1\x04"...)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(database)
+	}))
+	cache := &lib.Cache{Dir: t.TempDir(), MaxAge: time.Hour}
+	profile := &lib.Profile{CountryCode: "RU", Sources: []lib.Source{{Type: "mmdb", URL: server.URL}}}
+	expected := []string{"0.0.0.0/1"}
+
+	f := newFetcher(cache)
+	resources, err := f.fetchResources(profile)
+	if err != nil {
+		t.Fatalf("Ошибка fetchResources: %v", err)
+	}
+	if len(resources) != 1 || !reflect.DeepEqual(resources[0].resources, expected) {
+		t.Errorf("fetchResources() = %v; ожидается %v", resources, expected)
+	}
+	f.saveResponses()
+	if len(f.warnings) != 0 {
+		t.Fatalf("saveResponses(): предупреждения %v", f.warnings)
+	}
+
+	server.Close()
+	f = newFetcher(cache)
+	resources, err = f.fetchResources(profile)
+	if err != nil {
+		t.Fatalf("Ошибка fetchResources из кэша: %v", err)
+	}
+	if len(resources) != 1 || !reflect.DeepEqual(resources[0].resources, expected) {
+		t.Errorf("fetchResources() из кэша = %v; ожидается %v", resources, expected)
+	}
+	if len(f.warnings) != 1 || !f.stale {
+		t.Errorf("fetchResources() из кэша: предупреждения %v, stale %v; ожидается 1 и stale", f.warnings, f.stale)
+	}
+}
+
+// startDNSServer запускает сервер DNS, который отвечает адресом 192.0.2.1 на
+// запрос A для ok.test и NXDOMAIN на остальные. Возвращает адрес сервера.
+func startDNSServer(t *testing.T) (string, net.PacketConn) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("не удалось занять порт UDP: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			msg := append([]byte{}, buf[:n]...)
+			msg[2], msg[3] = 0x81, 0x83
+			if bytes.Contains(msg, []byte("\x02ok\x04test\x00")) {
+				msg[3], msg[7] = 0x80, 1
+				msg = append(msg, 0xc0, 12, 0, 1, 0, 1, 0, 0, 1, 0x2c, 0, 4, 192, 0, 2, 1)
+			}
+			conn.WriteTo(msg, addr)
+		}
+	}()
+	return conn.LocalAddr().String(), conn
+}
+
+// Тест для fetchResources с источником dns: домен без адресов пропускается
+// с предупреждением, а если не разрешился ни один домен, источник недоступен
+func TestFetchResourcesDNSSkip(t *testing.T) {
+	server, _ := startDNSServer(t)
+
+	tests := []struct {
+		domains  []string
+		expected []sourceResources
+		warnings int
+	}{
+		{[]string{"ok.test", "missing.test"}, []sourceResources{{name: "ok.test", resources: []string{"192.0.2.1/32"}}}, 1},
+		{[]string{"missing.test"}, nil, 1},
+	}
+
+	for _, test := range tests {
+		f := newFetcher(nil)
+		profile := &lib.Profile{Sources: []lib.Source{{Type: "dns", Domains: test.domains, Resolver: server}}}
+		resources, err := f.fetchResources(profile)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("fetchResources(%v) должна вернуть ошибку", test.domains)
+			}
+		} else if err != nil || !reflect.DeepEqual(resources, test.expected) {
+			t.Errorf("fetchResources(%v) = %v, %v; ожидается %v", test.domains, resources, err, test.expected)
+		}
+		if len(f.warnings) != test.warnings {
+			t.Errorf("fetchResources(%v): предупреждения %v; ожидается %d", test.domains, f.warnings, test.warnings)
+		}
+	}
+}
+
+// Тест для resolveConflicts: пересечение остается у профиля с большим приоритетом
+func TestResolveConflicts(t *testing.T) {
+	profiles := []lib.Profile{
+		{Name: "ru", Priority: 0},
+		{Name: "asn", Priority: 10},
+	}
+	ru, _ := cidrset.Parse("10.0.0.0/16", "192.168.0.0/24")
+	asn, _ := cidrset.Parse("10.0.1.0/24")
+
+	plans := resolveConflicts(profiles, []*cidrset.Set{ru, asn})
+
+	expectedRU := []string{
+		"10.0.0.0/24", "10.0.2.0/23", "10.0.4.0/22", "10.0.8.0/21", "10.0.16.0/20",
+		"10.0.32.0/19", "10.0.64.0/18", "10.0.128.0/17", "192.168.0.0/24",
+	}
+	if plans[0].profile.Name != "ru" || !reflect.DeepEqual(plans[0].subnets, expectedRU) {
+		t.Errorf("профиль ru = %v; ожидается %v", plans[0].subnets, expectedRU)
+	}
+	if !reflect.DeepEqual(plans[1].subnets, []string{"10.0.1.0/24"}) {
+		t.Errorf("профиль asn = %v; ожидается [10.0.1.0/24]", plans[1].subnets)
+	}
+}
+
+// Тест для retryNeeded: запуск с данными из кэша демон повторяет раньше
+func TestRetryNeeded(t *testing.T) {
+	tests := []struct {
+		code     int
+		stale    bool
+		expected bool
+	}{
+		{0, false, false},
+		{0, true, true},
+		{exitApply, false, false},
+		{exitApply, true, true},
+		{exitFetch, false, true},
+		{exitValidate, false, true},
+	}
+
+	for _, test := range tests {
+		if result := retryNeeded(test.code, test.stale); result != test.expected {
+			t.Errorf("retryNeeded(%d, %v) = %v; ожидается %v", test.code, test.stale, result, test.expected)
+		}
+	}
+}
+
+// Тест для fetchFailed: код завершения зависит от этапа
+func TestFetchFailed(t *testing.T) {
+	if code := fetchFailed(&stageError{exitValidate, errors.New("пусто")}); code != exitValidate {
+		t.Errorf("fetchFailed() = %d; ожидается %d", code, exitValidate)
+	}
+	if code := fetchFailed(errors.New("сеть")); code != exitFetch {
+		t.Errorf("fetchFailed() = %d; ожидается %d", code, exitFetch)
+	}
+}
+
+// Тест для commandArgs: прежние флаги переводятся в подкоманды
+func TestCommandArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		name     string
+		expected []string
+	}{
+		{nil, "apply", nil},
+		{[]string{"-d"}, "remove", []string{}},
+		{[]string{"-s"}, "apply", []string{"-add-only"}},
+		{[]string{"-p", "-profile", "ru"}, "plan", []string{"-profile", "ru"}},
+		{[]string{"-profile", "ru"}, "apply", []string{"-profile", "ru"}},
+		{[]string{"verify", "-fix"}, "verify", []string{"-fix"}},
+		{[]string{"-h"}, "help", nil},
+	}
+
+	for _, test := range tests {
+		name, args := commandArgs(test.args)
+		if name != test.name || !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("commandArgs(%v) = %s %v; ожидается %s %v", test.args, name, args, test.name, test.expected)
+		}
+	}
+}
+
 // Тест для ipRangeToCIDR
-//func TestIpRangeToCIDR(t *testing.T) {
-//	tests := []struct {
-//		start    string
-//		end      string
-//		expected []string
-//	}{
-//		{"192.168.0.0", "192.168.0.255", []string{"192.168.0.0/24"}},
-//		{"192.168.0.0", "192.168.1.255", []string{"192.168.0.0/23"}},
-//		{"10.0.0.0", "10.0.0.15", []string{"10.0.0.0/28"}},
-//		{"10.0.0.0", "10.0.0.0", []string{"10.0.0.0/32"}},
-//	}
-//
-//	for _, test := range tests {
-//		result, err := ipRangeToCIDR(test.start, test.end)
-//		if err != nil {
-//			t.Errorf("Ошибка ipRangeToCIDR(%s, %s): %v", test.start, test.end, err)
-//		}
-//		if !reflect.DeepEqual(result, test.expected) {
-//			t.Errorf("ipRangeToCIDR(%s, %s) = %v; ожидается %v", test.start, test.end, result, test.expected)
-//		}
-//	}
-//}
-//
-//// Тест для summarizeSubnets
-//func TestSummarizeSubnets(t *testing.T) {
-//	tests := []struct {
-//		subnets  []string
-//		expected []string
-//	}{
-//		{
-//			subnets:  []string{"192.168.0.0/24", "192.168.1.0/24"},
-//			expected: []string{"192.168.0.0/23"},
-//		},
-//		{
-//			subnets:  []string{"10.0.0.0/28", "10.0.0.16/28"},
-//			expected: []string{"10.0.0.0/27"}, // Ожидается объединение
-//		},
-//		{
-//			subnets:  []string{"10.0.0.0/32", "10.0.0.1/32"},
-//			expected: []string{"10.0.0.0/31"},
-//		},
-//		{
-//			subnets:  []string{"192.168.0.0/24"},
-//			expected: []string{"192.168.0.0/24"},
-//		},
-//	}
-//
-//	for _, test := range tests {
-//		result := summarizeSubnets(test.subnets)
-//		if !reflect.DeepEqual(result, test.expected) {
-//			t.Errorf("summarizeSubnets(%v) = %v; ожидается %v", test.subnets, result, test.expected)
-//		}
-//	}
-//}
-//
-//// Тест для filterSubnets
-//func TestFilterSubnets(t *testing.T) {
-//	tests := []struct {
-//		cidr     string
-//		ignored  map[string]bool
-//		expected []string
-//	}{
-//		{
-//			cidr: "192.168.0.0/30",
-//			ignored: map[string]bool{
-//				"192.168.0.1": true,
-//				"192.168.0.3": true,
-//			},
-//			expected: []string{"192.168.0.0/32", "192.168.0.2/32"},
-//		},
-//		{
-//			cidr: "10.0.0.0/29",
-//			ignored: map[string]bool{
-//				"10.0.0.1": true,
-//				"10.0.0.5": true,
-//			},
-//			expected: []string{"10.0.0.0/32", "10.0.0.2/32", "10.0.0.3/32", "10.0.0.4/32", "10.0.0.6/32", "10.0.0.7/32"},
-//		},
-//		{
-//			cidr: "192.168.1.0/29",
-//			ignored: map[string]bool{
-//				"192.168.1.2": true,
-//				"192.168.1.6": true,
-//			},
-//			expected: []string{"192.168.1.0/32", "192.168.1.1/32", "192.168.1.3/32", "192.168.1.4/32", "192.168.1.5/32", "192.168.1.7/32"},
-//		},
-//		{
-//			cidr: "10.0.0.0/8",
-//			ignored: map[string]bool{
-//				"10.134.1.1": true,
-//			},
-//			expected: []string{
-//				"10.0.0.0/32", "10.0.0.1/32", "...", // Все адреса до 10.134.1.0
-//				"10.134.1.0/32", "10.134.1.2/32", "...", // Все после 10.134.1.1
-//			},
-//		},
-//	}
-//
-//	for _, test := range tests {
-//		result, err := filterSubnets(test.cidr, test.ignored)
-//		if err != nil {
-//			t.Errorf("Ошибка filterSubnets(%s, %v): %v", test.cidr, test.ignored, err)
-//		}
-//		if !reflect.DeepEqual(result, test.expected) {
-//			t.Errorf("filterSubnets(%s, %v) = %v; ожидается %v", test.cidr, test.ignored, result, test.expected)
-//		}
-//	}
-//}
-//
-//func TestSummarizeSubnetsWithExclusions(t *testing.T) {
-//	tests := []struct {
-//		subnets  []string
-//		excluded []string
-//		expected []string
-//	}{
-//		{
-//			subnets:  []string{"10.0.0.0/8"},
-//			excluded: []string{"10.134.1.24"},
-//			expected: []string{
-//				"10.0.0.0/9", "10.128.0.0/11", "10.132.0.0/15", "10.134.0.0/24",
-//				"10.134.1.0/32", "10.134.1.2/31", "10.134.1.4/22", "10.134.2.0/15",
-//				"10.136.0.0/13", "10.144.0.0/12", "10.160.0.0/11", "10.192.0.0/10",
-//			},
-//		},
-//	}
-//
-//	for _, test := range tests {
-//		result, _ := summarizeSubnetsWithExclusions(test.subnets, test.excluded)
-//		if !reflect.DeepEqual(result, test.expected) {
-//			t.Errorf("summarizeSubnetsWithExclusions(%v, %v) = %v; ожидается %v",
-//				test.subnets, test.excluded, result, test.expected)
-//		}
-//	}
-//}
+func TestIpRangeToCIDR(t *testing.T) {
+	tests := []struct {
+		start    string
+		end      string
+		expected []string
+	}{
+		{"192.168.0.0", "192.168.0.255", []string{"192.168.0.0/24"}},
+		{"192.168.0.0", "192.168.1.255", []string{"192.168.0.0/23"}},
+		{"10.0.0.0", "10.0.0.15", []string{"10.0.0.0/28"}},
+		{"10.0.0.0", "10.0.0.0", []string{"10.0.0.0/32"}},
+		{"10.0.0.1", "10.0.0.6", []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{"10.0.0.5", "10.0.0.1", nil},
+		{"10.0.0.0", "2001:db8::", nil},
+	}
+
+	for _, test := range tests {
+		result, err := ipRangeToCIDR(test.start, test.end)
+		if (err == nil) != (test.expected != nil) {
+			t.Errorf("ipRangeToCIDR(%s, %s) = %v, %v; ожидается %v", test.start, test.end, result, err, test.expected)
+			continue
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("ipRangeToCIDR(%s, %s) = %v; ожидается %v", test.start, test.end, result, test.expected)
+		}
+	}
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Max121279/routing_ripe/src/lib"
+	"github.com/Max121279/routing_ripe/src/lib/cidrset"
+)
+
+const baseURL = "https://stat.ripe.net/data/country-resource-list/data.json?resource="
+
+// Коды завершения, по которым скрипты и cron-обертки могут различать ошибки.
+// При exitFetch и exitValidate установленные маршруты не изменяются.
+const (
+	exitConfig   = 1 // ошибка конфигурации
+	exitFetch    = 2 // не удалось получить данные RIPE
+	exitValidate = 3 // данные RIPE не прошли проверку
+	exitApply    = 4 // ошибка при установке маршрутов
+	exitDiff     = 5 // diff и verify: установленное отличается от вычисленного
+	exitUsage    = 6 // неверные аргументы командной строки
+)
+
+// maxConflictsShown - сколько конфликтующих подсетей выводится для пары профилей
+const maxConflictsShown = 10
+
+// stageError - ошибка этапа обновления вместе с кодом завершения
+type stageError struct {
+	code int
+	err  error
+}
+
+func (e *stageError) Error() string { return e.err.Error() }
+
+// profilePlan - итоговый набор подсетей профиля
+type profilePlan struct {
+	profile lib.Profile
+	subnets []string
+}
+
+// sourceResources - ресурсы одной страны из одного источника
+type sourceResources struct {
+	name      string
+	resources []string
+	// group - номер источника в профиле; запасной источник получает номер
+	// того, который он заменил
+	group int
+}
+
+// fetchSubnets выполняет для всех профилей этапы загрузки, проверки и
+// вычисления, распределяет пересечения между профилями и возвращает
+// итоговые наборы подсетей и предупреждения. stale сообщает, что часть данных
+// взята из кэша, а не получена заново.
+// Ничего не меняет в системе, поэтому при ошибке маршруты остаются прежними.
+// Загруженные ответы сохраняются в кэш, только когда все профили прошли проверку.
+func fetchSubnets(config *lib.Config) (plans []profilePlan, warnings []string, stale bool, err error) {
+	cache, err := config.Cache()
+	if err != nil {
+		return nil, nil, false, &stageError{exitConfig, err}
+	}
+	f := newFetcher(cache)
+
+	profiles := config.RoutingProfiles()
+	sets := make([]*cidrset.Set, len(profiles))
+	for i := range profiles {
+		profile := &profiles[i]
+		sources, err := f.fetchResources(profile)
+		if err != nil {
+			return nil, nil, false, &stageError{exitFetch, fmt.Errorf("профиль %s: %v", profile.Name, err)}
+		}
+		includes, err := includedResources(profile)
+		if err != nil {
+			return nil, nil, false, &stageError{exitFetch, fmt.Errorf("профиль %s: %v", profile.Name, err)}
+		}
+		if err = validateResources(sources); err != nil {
+			return nil, nil, false, &stageError{exitValidate, fmt.Errorf("профиль %s: %v", profile.Name, err)}
+		}
+		sets[i], err = computeSubnets(profile, sources, includes)
+		if err != nil {
+			return nil, nil, false, &stageError{exitValidate, fmt.Errorf("профиль %s: %v", profile.Name, err)}
+		}
+	}
+
+	f.saveResponses()
+	return resolveConflicts(profiles, sets), f.warnings, f.stale, nil
+}
+
+// ripeResources - ресурсы IPv4 и IPv6 одной страны
+type ripeResources struct {
+	ipv4 []string
+	ipv6 []string
+}
+
+// fetcher загружает ресурсы источников, запрашивая каждую страну RIPEstat
+// и каждый файл источника один раз за запуск
+type fetcher struct {
+	cache    *lib.Cache
+	fetched  map[string]ripeResources
+	files    map[string][]byte
+	warnings []string
+	// stale - часть данных взята из кэша или из прежнего ответа DNS
+	stale bool
+	// responses - свежие ответы, которые сохраняются в кэш после проверки
+	responses []*lib.RIPEResponse
+}
+
+// newFetcher создает загрузчик, который берет данные из кэша cache, если
+// источник недоступен. Без кэша ошибка загрузки сразу возвращается.
+func newFetcher(cache *lib.Cache) *fetcher {
+	return &fetcher{cache: cache, fetched: make(map[string]ripeResources), files: make(map[string][]byte)}
+}
+
+// fetchResources загружает ресурсы всех источников профиля. Источник с
+// fallback загружается, только если не удалось загрузить предыдущий.
+func (f *fetcher) fetchResources(profile *lib.Profile) ([]sourceResources, error) {
+	var resources []sourceResources
+	var failed error
+	group := -1
+	for _, source := range profile.DataSources() {
+		if source.Fallback && failed == nil {
+			continue
+		}
+		if !source.Fallback {
+			if failed != nil {
+				return nil, failed
+			}
+			group++
+		}
+
+		fetched, err := f.fetchSource(profile, &source)
+		if err != nil {
+			if len(profile.Sources) > 0 {
+				err = fmt.Errorf("источник %s: %v", source.String(), err)
+			}
+			if failed != nil {
+				err = fmt.Errorf("%v; %v", failed, err)
+			}
+			failed = err
+			continue
+		}
+		if failed != nil {
+			f.warnings = append(f.warnings, fmt.Sprintf("%v; использован источник %s", failed, source.String()))
+			failed = nil
+		}
+		for i := range fetched {
+			fetched[i].group = group
+		}
+		resources = append(resources, fetched...)
+	}
+	if failed != nil {
+		return nil, failed
+	}
+	return resources, nil
+}
+
+// fetchSource загружает ресурсы стран из одного источника
+func (f *fetcher) fetchSource(profile *lib.Profile, source *lib.Source) ([]sourceResources, error) {
+	if len(source.Countries) == 0 && source.ByCountry() {
+		return nil, fmt.Errorf("не задан ни один код страны")
+	}
+
+	var resources []sourceResources
+	switch source.Type {
+	case lib.SourceRIPEstat:
+		for _, country := range source.Countries {
+			data, err := f.fetchCountry(country)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", country, err)
+			}
+			resources = append(resources, sourceResources{name: country, resources: data.resources(profile.IPv6)})
+		}
+	case lib.SourceDelegated, lib.SourceMMDB:
+		body, err := f.fetchFile(source.Location(), lib.FetchSource)
+		if err != nil {
+			return nil, err
+		}
+		var parsed map[string]lib.CountryResources
+		if source.Type == lib.SourceDelegated {
+			parsed, err = lib.ParseDelegated(body, source.Countries, source.Statuses)
+		} else {
+			parsed, err = lib.ParseCountryDatabase(body, source.Countries)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, country := range source.Countries {
+			data := ripeResources{parsed[country].IPv4, parsed[country].IPv6}
+			resources = append(resources, sourceResources{
+				name:      country + " (" + source.String() + ")",
+				resources: data.resources(profile.IPv6),
+			})
+		}
+	case lib.SourceASN:
+		var names []string
+		var prefixLists [][]string
+		if source.Path != "" {
+			prefixes, err := f.fetchPrefixes(source.Path, lib.FetchSource)
+			if err != nil {
+				return nil, err
+			}
+			names, prefixLists = append(names, source.Path), append(prefixLists, prefixes)
+		}
+		for _, value := range source.ASNs {
+			asn, err := lib.ParseASN(value)
+			if err != nil {
+				return nil, err
+			}
+			name := fmt.Sprintf("AS%d", asn)
+			prefixes, err := f.fetchPrefixes(fmt.Sprintf("%s%d", lib.AnnouncedPrefixesURL, asn), lib.FetchRIPEstat)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			names, prefixLists = append(names, name), append(prefixLists, prefixes)
+		}
+		// Пустой ответ проверяется в validateResources, а AS, которая анонсирует
+		// только IPv6, при выключенном ipv6 пропускается с предупреждением
+		for i, prefixes := range prefixLists {
+			filtered := familyResources(prefixes, profile.IPv6)
+			if len(filtered) == 0 && len(prefixes) > 0 {
+				f.warnings = append(f.warnings, fmt.Sprintf("%s анонсирует только подсети IPv6, ipv6 у профиля выключен", names[i]))
+				continue
+			}
+			resources = append(resources, sourceResources{name: names[i], resources: filtered})
+		}
+	case lib.SourceDNS:
+		resolver := resolverFor(source.Resolver)
+		qtypes := []uint16{lib.DNSTypeA}
+		if profile.IPv6 {
+			qtypes = append(qtypes, lib.DNSTypeAAAA)
+		}
+		// Домен, который не удалось разрешить или у которого нет адресов,
+		// пропускается с предупреждением, чтобы не останавливать весь профиль
+		for _, domain := range source.Domains {
+			var prefixes []string
+			var resolveErr error
+			for _, qtype := range qtypes {
+				entry, err := f.resolve(resolver, domain, qtype)
+				if err != nil {
+					resolveErr = err
+					continue
+				}
+				if entry.Stale {
+					f.staleWarning("адреса %s взяты из ответа DNS от %s", entry.Name, entry.Refreshed, nil)
+				}
+				for _, addr := range entry.Addrs {
+					prefix, err := addr.Prefix(source.PrefixBits(addr.Is4()))
+					if err != nil {
+						return nil, err
+					}
+					prefixes = append(prefixes, prefix.String())
+				}
+			}
+			if len(prefixes) == 0 {
+				if resolveErr == nil {
+					resolveErr = fmt.Errorf("нет адресов")
+				}
+				f.warnings = append(f.warnings, fmt.Sprintf("домен %s пропущен: %v", domain, resolveErr))
+				continue
+			}
+			resources = append(resources, sourceResources{name: domain, resources: prefixes})
+		}
+		if len(resources) == 0 {
+			return nil, fmt.Errorf("не удалось получить адреса ни одного домена")
+		}
+	default:
+		return nil, fmt.Errorf("неизвестный тип источника %s", source.Type)
+	}
+	return resources, nil
+}
+
+// resolvers - клиенты DNS по адресу сервера. Они живут все время работы,
+// чтобы в режиме демона ответы DNS повторно запрашивались только по истечении TTL.
+var resolvers = make(map[string]*lib.Resolver)
+
+// resolverFor возвращает клиент DNS для сервера server
+func resolverFor(server string) *lib.Resolver {
+	resolver, ok := resolvers[server]
+	if !ok {
+		resolver = lib.NewResolver(server)
+		resolvers[server] = resolver
+	}
+	return resolver
+}
+
+// resolve запрашивает адреса домена. Свежий ответ сохраняется в кэш вместе
+// с остальными ответами после проверки, а при ошибке DNS берется ответ из
+// кэша: при запуске по расписанию прежних ответов в памяти нет.
+func (f *fetcher) resolve(resolver *lib.Resolver, domain string, qtype uint16) (*lib.DNSEntry, error) {
+	key := fmt.Sprintf("dns://%s/%s/%d", resolver.Server, strings.ToLower(domain), qtype)
+	entry, err := resolver.Resolve(domain, qtype)
+	if err == nil {
+		if !entry.Stale {
+			body, err := json.Marshal(entry.Addrs)
+			if err != nil {
+				return nil, err
+			}
+			f.responses = append(f.responses, &lib.RIPEResponse{URL: key, Body: body, FetchedAt: entry.Refreshed})
+		}
+		return entry, nil
+	}
+	if f.cache == nil {
+		return nil, err
+	}
+	cached, cacheErr := f.cache.Load(key)
+	if cacheErr != nil {
+		return nil, err
+	}
+	var addrs []netip.Addr
+	if json.Unmarshal(cached.Body, &addrs) != nil {
+		return nil, err
+	}
+	return &lib.DNSEntry{Name: domain, Type: qtype, Addrs: addrs, Refreshed: cached.FetchedAt, Stale: true}, nil
+}
+
+// fetchPrefixes загружает и разбирает анонсы автономной системы
+func (f *fetcher) fetchPrefixes(location string, fetch fetchFunc) ([]string, error) {
+	body, err := f.fetchFile(location, fetch)
+	if err != nil {
+		return nil, err
+	}
+	return lib.ParseAnnouncedPrefixes(body)
+}
+
+// familyResources убирает подсети IPv6, если профиль их не использует
+func familyResources(resources []string, ipv6 bool) []string {
+	if ipv6 {
+		return resources
+	}
+	var filtered []string
+	for _, resource := range resources {
+		if !strings.Contains(resource, ":") {
+			filtered = append(filtered, resource)
+		}
+	}
+	return filtered
+}
+
+// resources возвращает ресурсы IPv4, а с ipv6 - и ресурсы IPv6
+func (r ripeResources) resources(ipv6 bool) []string {
+	if !ipv6 {
+		return r.ipv4
+	}
+	return append(slices.Clip(r.ipv4), r.ipv6...)
+}
+
+// fetchFunc загружает данные по адресу с учетом кэша: lib.FetchSource или lib.FetchRIPEstat
+type fetchFunc func(location string, cache *lib.Cache) (*lib.RIPEResponse, error)
+
+// fetchFile загружает файл источника функцией fetch или берет уже загруженный
+func (f *fetcher) fetchFile(location string, fetch fetchFunc) ([]byte, error) {
+	if body, ok := f.files[location]; ok {
+		return body, nil
+	}
+	resp, err := fetch(location, f.cache)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Stale {
+		f.staleWarning("данные %s взяты из кэша от %s", location, resp.FetchedAt, resp.FetchErr)
+	}
+	f.files[location] = resp.Body
+	f.responses = append(f.responses, resp)
+	return resp.Body, nil
+}
+
+// staleWarning отмечает, что данные name взяты из сохраненного в at ответа,
+// так как загрузка завершилась ошибкой reason
+func (f *fetcher) staleWarning(format, name string, at time.Time, reason error) {
+	f.stale = true
+	warning := fmt.Sprintf(format, name, at.Format("2006-01-02 15:04"))
+	if reason != nil {
+		warning += fmt.Sprintf(" (%v)", reason)
+	}
+	f.warnings = append(f.warnings, warning)
+}
+
+// saveResponses сохраняет в кэш свежие ответы, прошедшие проверку
+func (f *fetcher) saveResponses() {
+	for _, resp := range f.responses {
+		if err := resp.Save(f.cache); err != nil {
+			f.warnings = append(f.warnings, err.Error())
+		}
+	}
+	f.responses = nil
+}
+
+// fetchCountry загружает ресурсы страны из RIPEstat или из уже загруженных
+func (f *fetcher) fetchCountry(country string) (ripeResources, error) {
+	if data, ok := f.fetched[country]; ok {
+		return data, nil
+	}
+
+	resp, err := lib.FetchRIPEstat(baseURL+country, f.cache)
+	if err != nil {
+		return ripeResources{}, err
+	}
+	if resp.Stale {
+		f.staleWarning("данные %s взяты из кэша от %s", country, resp.FetchedAt, resp.FetchErr)
+	}
+
+	var result struct {
+		Data struct {
+			Resources struct {
+				IPv4 []string `json:"ipv4"`
+				IPv6 []string `json:"ipv6"`
+			} `json:"resources"`
+		} `json:"data"`
+	}
+	if err = json.Unmarshal(resp.Body, &result); err != nil {
+		return ripeResources{}, fmt.Errorf("ошибка разбора JSON: %v", err)
+	}
+
+	data := ripeResources{result.Data.Resources.IPv4, result.Data.Resources.IPv6}
+	f.fetched[country] = data
+	f.responses = append(f.responses, resp)
+	return data, nil
+}
+
+// includedResources возвращает подсети, добавленные вручную: included_subnets
+// и содержимое файлов included_files
+func includedResources(profile *lib.Profile) ([]sourceResources, error) {
+	var includes []sourceResources
+	if len(profile.IncludedSubnets) > 0 {
+		includes = append(includes, sourceResources{
+			name:      "included_subnets",
+			resources: familyResources(profile.IncludedSubnets, profile.IPv6),
+		})
+	}
+	for _, path := range profile.IncludedFiles {
+		prefixes, err := lib.ReadPrefixList(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		includes = append(includes, sourceResources{name: path, resources: familyResources(prefixes, profile.IPv6)})
+	}
+	return includes, nil
+}
+
+// validateResources проверяет, что источники вернули для каждой страны
+// непустой список корректных ресурсов
+func validateResources(sources []sourceResources) error {
+	for _, source := range sources {
+		if len(source.resources) == 0 {
+			return fmt.Errorf("получен пустой список ресурсов для %s", source.name)
+		}
+		for _, resource := range source.resources {
+			if _, err := parseResource(resource); err != nil {
+				return fmt.Errorf("%s: %v", source.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// computeSubnets строит набор подсетей профиля: объединяет или пересекает
+// наборы источников, при invert берет дополнение до публичного юникаста, добавляет подсети,
+// добавленные вручную, исключает игнорируемые адреса и подсети и проверяет результат
+func computeSubnets(profile *lib.Profile, sources, includes []sourceResources) (*cidrset.Set, error) {
+	set, err := combineResources(sources, profile.Combine)
+	if err != nil {
+		return nil, err
+	}
+
+	if profile.Invert {
+		set = lib.PublicUnicast(profile.IPv6).Subtract(set)
+	}
+
+	// Добавленные вручную подсети не инвертируются
+	included, err := unionResources(includes)
+	if err != nil {
+		return nil, err
+	}
+	set = set.Union(included)
+
+	// Исключаем игнорируемые адреса и подсети
+	exclusions, err := lib.NewExclusions(profile.IgnoredIPs, profile.IgnoredSubnets)
+	if err != nil {
+		return nil, err
+	}
+	set, overlaps := exclusions.Apply(set)
+	for _, overlap := range overlaps {
+		fmt.Printf("Профиль %s: исключение %s пересекается с набором подсетей: %s адресов\n",
+			profile.Name, overlap.Exclusion, overlap.Addresses)
+	}
+
+	// Проверяем, что ни одна итоговая подсеть не содержит исключенных адресов
+	if err = exclusions.Verify(set.Strings()); err != nil {
+		return nil, fmt.Errorf("нарушена проверка исключений: %v", err)
+	}
+
+	return set, nil
+}
+
+// combineResources объединяет ресурсы каждого источника в набор, а наборы
+// источников объединяет или, с combine intersect, пересекает
+func combineResources(sources []sourceResources, combine string) (*cidrset.Set, error) {
+	var grouped [][]sourceResources
+	for _, source := range sources {
+		for len(grouped) <= source.group {
+			grouped = append(grouped, nil)
+		}
+		grouped[source.group] = append(grouped[source.group], source)
+	}
+	if len(grouped) == 0 {
+		return &cidrset.Set{}, nil
+	}
+
+	var result *cidrset.Set
+	for i, group := range grouped {
+		set, err := unionResources(group)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case i == 0:
+			result = set
+		case combine == lib.CombineIntersect:
+			result = result.Intersect(set)
+		default:
+			result = result.Union(set)
+		}
+	}
+	return result, nil
+}
+
+// unionResources объединяет ресурсы в один набор. Все ресурсы разбираются
+// одним вызовом cidrset.Parse, который сортирует и сливает диапазоны сразу,
+// а не объединяет набор с каждым ресурсом по очереди.
+func unionResources(sources []sourceResources) (*cidrset.Set, error) {
+	var values []string
+	for _, source := range sources {
+		values = append(values, source.resources...)
+	}
+	set, err := cidrset.Parse(values...)
+	if err != nil {
+		// Ищем источник с некорректным ресурсом, чтобы назвать его в ошибке
+		for _, source := range sources {
+			if _, sourceErr := cidrset.Parse(source.resources...); sourceErr != nil {
+				return nil, fmt.Errorf("%s: %v", source.name, sourceErr)
+			}
+		}
+		return nil, err
+	}
+	return set, nil
+}
+
+// resolveConflicts распределяет пересекающиеся подсети между профилями:
+// подсеть остается у профиля с большим priority (при равенстве - у описанного
+// в конфигурации раньше), из остальных она вычитается и выводится как конфликт
+func resolveConflicts(profiles []lib.Profile, sets []*cidrset.Set) []profilePlan {
+	order := make([]int, len(profiles))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return profiles[b].Priority - profiles[a].Priority })
+
+	plans := make([]profilePlan, len(profiles))
+	var owners []int
+	for _, i := range order {
+		set := sets[i]
+		for _, owner := range owners {
+			common := set.Intersect(sets[owner])
+			if common.IsEmpty() {
+				continue
+			}
+			conflicts := common.Strings()
+			fmt.Printf("Конфликт профилей %s и %s: %d подсетей остаются у %s\n",
+				profiles[i].Name, profiles[owner].Name, len(conflicts), profiles[owner].Name)
+			for _, conflict := range conflicts[:min(len(conflicts), maxConflictsShown)] {
+				fmt.Printf("  %s\n", conflict)
+			}
+			if len(conflicts) > maxConflictsShown {
+				fmt.Printf("  ... и еще %d\n", len(conflicts)-maxConflictsShown)
+			}
+			set = set.Subtract(common)
+		}
+		sets[i] = set
+		owners = append(owners, i)
+		plans[i] = profilePlan{profiles[i], set.Strings()}
+	}
+	return plans
+}
+
+// parseResource разбирает ресурс RIPE: подсеть или диапазон адресов
+func parseResource(resource string) (*cidrset.Set, error) {
+	cidrs := []string{resource}
+	if ips := strings.Split(resource, "-"); len(ips) == 2 {
+		var err error
+		cidrs, err = ipRangeToCIDR(ips[0], ips[1])
+		if err != nil {
+			return nil, fmt.Errorf("некорректный ресурс RIPE %s: %v", resource, err)
+		}
+	}
+	set, err := cidrset.Parse(cidrs...)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный ресурс RIPE %s: %v", resource, err)
+	}
+	return set, nil
+}
+
+// ipRangeToCIDR преобразует диапазон адресов в минимальный набор подсетей
+func ipRangeToCIDR(start, end string) ([]string, error) {
+	startIP, err := netip.ParseAddr(start)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный формат IP: %s - %s", start, end)
+	}
+	endIP, err := netip.ParseAddr(end)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный формат IP: %s - %s", start, end)
+	}
+
+	set, err := cidrset.FromRange(startIP, endIP)
+	if err != nil {
+		return nil, err
+	}
+	return set.Strings(), nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Max121279/routing_ripe/src/lib"
+)
+
+// watchSettle - сколько ждать после события, пока интерфейс перестанет меняться
+const watchSettle = 3 * time.Second
+
+// watchInterfaces следит за интерфейсами профилей и, когда интерфейс
+// снова поднимается, устанавливает маршруты из файла подсетей без запроса RIPE
+func watchInterfaces(env *environment) int {
+	profiles := make(map[string][]lib.Profile)
+	var names []string
+	for _, profile := range env.profiles() {
+		ifaces := []string{profile.Interface}
+		if profile.InterfaceV6 != profile.Interface {
+			ifaces = append(ifaces, profile.InterfaceV6)
+		}
+		for _, iface := range ifaces {
+			if iface == "" {
+				continue
+			}
+			if !slices.Contains(names, iface) {
+				names = append(names, iface)
+			}
+			profiles[iface] = append(profiles[iface], profile)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Println("Ни у одного профиля не задан интерфейс, следить не за чем")
+		return exitConfig
+	}
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	events, err := lib.WatchLinks(names, stop)
+	if err != nil {
+		fmt.Printf("Ошибка слежения за интерфейсами: %v\n", err)
+		return exitApply
+	}
+	fmt.Printf("Слежение за интерфейсами: %s\n", strings.Join(names, ", "))
+
+	// События при переподключении приходят пачкой, маршруты
+	// восстанавливаются, когда интерфейс перестал меняться
+	pending := make(map[string]bool)
+	settle := time.NewTimer(watchSettle)
+	settle.Stop()
+	for {
+		select {
+		case name, ok := <-events:
+			if !ok {
+				select {
+				case <-stop:
+					fmt.Println("Слежение остановлено")
+					return 0
+				default:
+					return exitApply
+				}
+			}
+			pending[name] = true
+			settle.Reset(watchSettle)
+		case <-settle.C:
+			restored := make(map[string]bool)
+			for _, iface := range names {
+				if !pending[iface] {
+					continue
+				}
+				for _, profile := range profiles[iface] {
+					if restored[profile.Name] {
+						continue
+					}
+					restored[profile.Name] = true
+					fmt.Printf("Интерфейс %s поднялся, профиль %s: восстановление маршрутов...\n", iface, profile.Name)
+					restoreRoutes(profile, env.backends[profile.Name])
+				}
+			}
+			pending = make(map[string]bool)
+		}
+	}
+}
+
+// restoreRoutes заново устанавливает последний вычисленный набор подсетей
+// профиля и его правила
+func restoreRoutes(profile lib.Profile, backend lib.RouteBackend) {
+	if err := lib.AddRoutes(backend, profile.FilePath); err != nil {
+		fmt.Printf("Ошибка при восстановлении маршрутов: %v\n", err)
+	}
+	if err := applyPolicy(&profile); err != nil {
+		fmt.Printf("Ошибка при установке правил: %v\n", err)
+	}
+}